@@ -4,8 +4,11 @@ Package bill provides work with files of reports on financial transactions of co
 package bill
 
 import (
+	"encoding/json"
 	"math"
+	"math/big"
 	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
 )
@@ -41,6 +44,13 @@ func worstError(e1, e2 error) error {
 	return e2
 }
 
+// isUnsupported says whether the error is an UnsupportedBill error.
+func isUnsupported(err error) bool {
+	_, ok := err.(UnsupportedBill)
+
+	return ok
+}
+
 type (
 	Type      interface{}
 	Value     interface{}
@@ -53,6 +63,8 @@ type Body struct {
 	Type  *Type  `json:"type"`
 	Value *Value `json:"value"`
 	ID    *ID    `json:"id"`
+	// Counterparty is the other company of a transfer between companies, optional.
+	Counterparty *Company `json:"counterparty"`
 }
 
 type Operation struct {
@@ -64,227 +76,237 @@ type Bill struct {
 	Company *Company `json:"company"`
 	*Operation
 	OperationStruct *Operation `json:"operation"`
+
+	unknown []string
+}
+
+// toInt64 converts the float64 number to int64 if it is an integer that fits into int64.
+func toInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(f), true
 }
 
-// isInteger checks if the given float64 number is an integer.
-func isInteger(f float64) bool {
-	return math.Abs(f-float64(int(f))) <= 1e-16
+// integerOf converts the JSON number to int64 if it is an integer that fits into int64. Unlike toInt64 the number is
+// checked exactly, so large integers do not lose precision and integers written as 2.0 or 1e3 are accepted.
+func integerOf(n json.Number) (int64, bool) {
+	if i, err := n.Int64(); err == nil {
+		return i, true
+	}
+
+	f, err := n.Float64()
+
+	if err != nil || math.Abs(f) >= math.MaxInt64 {
+		return 0, false
+	}
+
+	// A number that underflows to zero is an integer only if all of its digits are zero (and big.Rat would spend
+	// memory on its exponent).
+	if f == 0 {
+		mantissa := strings.ToLower(n.String())
+
+		if i := strings.IndexByte(mantissa, 'e'); i >= 0 {
+			mantissa = mantissa[:i]
+		}
+
+		return 0, !strings.ContainsAny(mantissa, "123456789")
+	}
+
+	r, ok := new(big.Rat).SetString(n.String())
+
+	if !ok || !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+
+	return r.Num().Int64(), true
 }
 
-// parseType checks the Type for validity and returns a pointer to a value with an error.
-func parseType(opType *Type) (*string, error) {
+// parseType checks the Type for validity according to the profile and returns the direction of the operation with
+// an error.
+func (p Profile) parseType(opType *Type) (Direction, error) {
 	if opType == nil {
-		return nil, InvalidBill{msg: "operation type was not passed"}
+		return 0, InvalidBill{msg: "operation type was not passed"}
 	}
 
 	invalidType := InvalidBill{
 		msg: "operation type can only take one of the values: \"income\", \"outcome\", \"+\", \"-\"",
 	}
 
-	switch (*opType).(type) {
+	switch str := (*opType).(type) {
 	case string:
-		str := (*opType).(string)
+		direction, ok := p.direction(str)
 
-		if !(str == "income" || str == "outcome" || str == "+" || str == "-") {
-			return nil, invalidType
+		if !ok {
+			return 0, invalidType
 		}
 
-		return &str, nil
+		return direction, nil
 	default:
-		return nil, invalidType
+		return 0, invalidType
 	}
 }
 
-// parseValue checks the Value for validity and returns a pointer to a value of one of the possible types with an error.
-func parseValue(value *Value) (*float64, *string, error) {
+// parseValue checks the Value for validity and returns the exact amount of the operation with an error.
+func parseValue(value *Value) (int64, error) {
 	if value == nil {
-		return nil, nil, InvalidBill{msg: "operation value was not passed"}
+		return 0, InvalidBill{msg: "operation value was not passed"}
 	}
 
 	invalidValue := InvalidBill{
 		msg: "operation value can only be of the following types: int, float (always integer), string (always integer)",
 	}
 
-	switch (*value).(type) {
+	switch v := (*value).(type) {
+	case json.Number:
+		amount, ok := integerOf(v)
+
+		if !ok {
+			return 0, invalidValue
+		}
+
+		return amount, nil
 	case float64:
-		flt := (*value).(float64)
+		amount, ok := toInt64(v)
 
-		if !isInteger(flt) {
-			return nil, nil, invalidValue
+		if !ok {
+			return 0, invalidValue
 		}
 
-		return &flt, nil, nil
+		return amount, nil
 	case string:
-		str := (*value).(string)
+		amount, err := strconv.ParseInt(v, 10, 64)
 
-		if _, err := strconv.Atoi(str); err != nil {
-			return nil, nil, invalidValue
+		if err != nil {
+			return 0, invalidValue
 		}
 
-		return nil, &str, nil
+		return amount, nil
 	default:
-		return nil, nil, invalidValue
+		return 0, invalidValue
 	}
 }
 
-// parseID checks the ID for validity and returns a pointer to a value of one of the possible types with an error.
-func parseID(id *ID) (*string, *float64, error) {
+// parseID checks the ID for validity and returns the typed id with an error.
+func parseID(id *ID) (OperationID, error) {
 	if id == nil {
-		return nil, nil, UnsupportedBill{msg: "operation id was not passed"}
+		return OperationID{}, UnsupportedBill{msg: "operation id was not passed"}
 	}
 
 	invalidID := UnsupportedBill{msg: "operation id can only be of type int and string"}
 
-	switch (*id).(type) {
+	switch v := (*id).(type) {
 	case string:
-		str := (*id).(string)
+		if utf8.RuneCountInString(v) == 0 {
+			return OperationID{}, invalidID
+		}
 
-		if utf8.RuneCountInString(str) == 0 {
-			return nil, nil, invalidID
+		return OperationID{Text: v}, nil
+	case json.Number:
+		if _, ok := integerOf(v); !ok {
+			return OperationID{}, invalidID
 		}
 
-		return &str, nil, nil
+		// The id keeps its lexical form in the output, 1 and 1.0 are still the same operation (but not "1").
+		return OperationID{Text: v.String(), Numeric: true}, nil
 	case float64:
-		flt := (*id).(float64)
-
-		if !isInteger(flt) {
-			return nil, nil, invalidID
+		if _, ok := toInt64(v); !ok {
+			return OperationID{}, invalidID
 		}
 
-		return nil, &flt, nil
+		return OperationID{Text: strconv.FormatFloat(v, 'f', -1, 64), Numeric: true}, nil
 	default:
-		return nil, nil, invalidID
+		return OperationID{}, invalidID
 	}
 }
 
-// parseCompany checks the Company for validity and returns a pointer to a value with an error.
-func parseCompany(company *Company) (*string, error) {
+// parseCompany checks the Company for validity and returns the company name with an error.
+func parseCompany(company *Company) (string, error) {
 	if company == nil {
-		return nil, UnsupportedBill{msg: "company was not passed"}
+		return "", UnsupportedBill{msg: "company was not passed"}
 	}
 
-	invalidCompany := UnsupportedBill{msg: "company name can only be a non-empty string"}
-
-	switch (*company).(type) {
+	switch str := (*company).(type) {
 	case string:
-		str := (*company).(string)
+		return checkCompany(str)
+	default:
+		return "", invalidCompany
+	}
+}
 
-		if utf8.RuneCountInString(str) == 0 {
-			return nil, invalidCompany
-		}
+var invalidCompany = UnsupportedBill{msg: "company name can only be a non-empty string"}
 
-		return &str, nil
-	default:
-		return nil, invalidCompany
+// checkCompany checks that the company name is not empty.
+func checkCompany(company string) (string, error) {
+	if utf8.RuneCountInString(company) == 0 {
+		return "", invalidCompany
 	}
+
+	return company, nil
 }
 
-// parseCreatedAt checks the CreatedAt for validity and returns a pointer to a value with an error.
-func parseCreatedAt(createdAt *CreatedAt) (*string, error) {
+// parseCreatedAt checks the CreatedAt for validity according to the profile and returns the time of the operation
+// with an error.
+func (p Profile) parseCreatedAt(createdAt *CreatedAt) (time.Time, error) {
 	if createdAt == nil {
-		return nil, UnsupportedBill{msg: "the \"created_at\" field was not passed"}
+		return time.Time{}, UnsupportedBill{msg: "the \"created_at\" field was not passed"}
 	}
 
-	invalidCreatedAt := UnsupportedBill{msg: "time must be a string in \"RFC3339\" format"}
+	invalidCreatedAt := UnsupportedBill{
+		msg: "time must be a string in one of the formats: \"" + strings.Join(p.TimeLayouts, "\", \"") + "\"",
+	}
 
-	switch (*createdAt).(type) {
+	switch str := (*createdAt).(type) {
 	case string:
-		str := (*createdAt).(string)
-		str = FormatQuotes(str)
+		createdTime, ok := p.parseTime(FormatQuotes(str))
 
-		if _, err := time.Parse(time.RFC3339, str); err != nil {
-			return nil, invalidCreatedAt
+		if !ok {
+			return time.Time{}, invalidCreatedAt
 		}
 
-		return &str, nil
+		return createdTime, nil
 	default:
-		return nil, invalidCreatedAt
+		return time.Time{}, invalidCreatedAt
 	}
 }
 
-// checkBody checks the Body for validity.
-func checkBody(body *Body) error {
-	if body == nil {
-		return UnsupportedBill{msg: "operation body was not passed"}
-	}
-
-	var err error
-
-	_, _, errID := parseID(body.ID)
-	_, errType := parseType(body.Type)
-	_, _, errValue := parseValue(body.Value)
-
-	for _, e := range [...]error{errID, errType, errValue} {
-		err = worstError(err, e)
-	}
-
-	return err
-}
-
-// checkOperation checks the embedded structure or field of Operation for validity.
-func checkOperation(bill Bill) error {
+// resolveOperation finds the body and the "created_at" field of the operation, which can be set either in the root
+// of the Bill or in its "operation" field.
+func resolveOperation(bill Bill) (*Body, *CreatedAt, error) {
 	operationRoot := bill.Operation
 	operationStruct := bill.OperationStruct
-	var (
-		body      *Body
-		createdAt *CreatedAt
-		err       error
-	)
 
 	switch {
 	case operationRoot != nil && operationStruct == nil:
-		body = operationRoot.Body
-		createdAt = operationRoot.CreatedAt
+		return operationRoot.Body, operationRoot.CreatedAt, nil
 	case operationRoot == nil && operationStruct != nil:
-		body = operationStruct.Body
-		createdAt = operationStruct.CreatedAt
+		return operationStruct.Body, operationStruct.CreatedAt, nil
 	case operationRoot != nil && operationStruct != nil:
 		switch {
 		case operationRoot.Body != nil && operationStruct.Body == nil:
-			body = operationRoot.Body
-
-			switch {
-			case operationRoot.CreatedAt == nil && operationStruct.CreatedAt != nil:
-				createdAt = operationStruct.CreatedAt
-			default:
-				return UnsupportedBill{msg: "one field \"created_at\" must be set"}
+			if operationRoot.CreatedAt == nil && operationStruct.CreatedAt != nil {
+				return operationRoot.Body, operationStruct.CreatedAt, nil
 			}
-		case operationRoot.Body == nil && operationStruct.Body != nil:
-			body = operationStruct.Body
 
-			switch {
-			case operationRoot.CreatedAt != nil && operationStruct.CreatedAt == nil:
-				createdAt = operationRoot.CreatedAt
-			default:
-				return UnsupportedBill{msg: "one field \"created_at\" must be set"}
+			return nil, nil, UnsupportedBill{msg: "one field \"created_at\" must be set"}
+		case operationRoot.Body == nil && operationStruct.Body != nil:
+			if operationRoot.CreatedAt != nil && operationStruct.CreatedAt == nil {
+				return operationStruct.Body, operationRoot.CreatedAt, nil
 			}
+
+			return nil, nil, UnsupportedBill{msg: "one field \"created_at\" must be set"}
 		default:
-			return UnsupportedBill{msg: "one operation body must be set"}
+			return nil, nil, UnsupportedBill{msg: "one operation body must be set"}
 		}
 	default:
-		return UnsupportedBill{msg: "operation was not passed"}
+		return nil, nil, UnsupportedBill{msg: "operation was not passed"}
 	}
-
-	_, errCreatedAt := parseCreatedAt(createdAt)
-	errBody := checkBody(body)
-
-	for _, e := range [...]error{errCreatedAt, errBody} {
-		err = worstError(err, e)
-	}
-
-	return err
 }
 
-// checkBill checks the Bill for validity.
+// checkBill checks the Bill for validity by the rules of the task.
 func checkBill(bill Bill) error {
-	var err error
-
-	_, errCompany := parseCompany(bill.Company)
-	errOperation := checkOperation(bill)
-
-	for _, e := range [...]error{errCompany, errOperation} {
-		err = worstError(err, e)
-	}
+	_, err := Normalize(bill)
 
 	return err
 }
@@ -0,0 +1,257 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// billingFile is the statement of the task, used as the golden input and the seed corpus.
+const billingFile = "../billing.json"
+
+// Kinds of the result of a bill check.
+const (
+	resultValid       = "valid"
+	resultInvalid     = "invalid"
+	resultUnsupported = "unsupported"
+)
+
+func resultOf(err error) string {
+	switch err.(type) {
+	case nil:
+		return resultValid
+	case InvalidBill:
+		return resultInvalid
+	case UnsupportedBill:
+		return resultUnsupported
+	default:
+		return "unexpected " + err.Error()
+	}
+}
+
+// checkBillCases cover the branches of the bill check: where the body and created_at may live and the checks of
+// every field.
+var checkBillCases = []struct {
+	name string
+	bill string
+	want string
+	// signed is the amount of a valid bill with the sign of its direction.
+	signed int64
+}{
+	{"flat", `{"company":"a","type":"income","value":1,"id":1,"created_at":"2021-10-13T12:02:39+03:00"}`, resultValid, 1},
+	{"nested", `{"company":"a","operation":{"type":"+","value":"2","id":"x","created_at":"2021-10-13T12:02:39Z"}}`,
+		resultValid, 2},
+	{"flat body, nested created_at",
+		`{"company":"a","type":"-","value":3,"id":1,"operation":{"created_at":"2021-10-13T12:02:39Z"}}`, resultValid, -3},
+	{"nested body, flat created_at",
+		`{"company":"a","operation":{"type":"outcome","value":3,"id":1},"created_at":"2021-10-13T12:02:39Z"}`,
+		resultValid, -3},
+	{"flat body, created_at in both places",
+		`{"company":"a","type":"-","value":3,"id":1,"created_at":"2021-10-13T12:02:39Z",` +
+			`"operation":{"created_at":"2021-10-13T12:02:39Z"}}`, resultUnsupported, 0},
+	{"nested body, created_at in both places",
+		`{"company":"a","operation":{"type":"-","value":3,"id":1,"created_at":"2021-10-13T12:02:39Z"},` +
+			`"created_at":"2021-10-13T12:02:39Z"}`, resultUnsupported, 0},
+	{"flat body, no created_at", `{"company":"a","type":"-","value":3,"id":1,"operation":{}}`, resultUnsupported, 0},
+	{"both bodies", `{"company":"a","type":"-","value":3,"id":1,"operation":{"type":"+","value":3,"id":2}}`,
+		resultUnsupported, 0},
+	{"only created_at", `{"company":"a","created_at":"2021-10-13T12:02:39Z"}`, resultUnsupported, 0},
+	{"no operation", `{"company":"a"}`, resultUnsupported, 0},
+	{"no company", `{"type":"+","value":1,"id":1,"created_at":"2021-10-13T12:02:39Z"}`, resultUnsupported, 0},
+	{"numeric company", `{"company":1,"type":"+","value":1,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+	{"empty company", `{"company":"","type":"+","value":1,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+	{"no id", `{"company":"a","type":"+","value":1,"created_at":"2021-10-13T12:02:39Z"}`, resultUnsupported, 0},
+	{"fractional id", `{"company":"a","type":"+","value":1,"id":1.5,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+	{"empty id", `{"company":"a","type":"+","value":1,"id":"","created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+	{"boolean id", `{"company":"a","type":"+","value":1,"id":true,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+	{"no created_at", `{"company":"a","type":"+","value":1,"id":1}`, resultUnsupported, 0},
+	{"malformed created_at", `{"company":"a","type":"+","value":1,"id":1,"created_at":"EghgioA"}`, resultUnsupported, 0},
+	{"numeric created_at", `{"company":"a","type":"+","value":1,"id":1,"created_at":1}`, resultUnsupported, 0},
+	{"no type", `{"company":"a","value":1,"id":1,"created_at":"2021-10-13T12:02:39Z"}`, resultInvalid, 0},
+	{"unknown type", `{"company":"a","type":"refund","value":1,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultInvalid, 0},
+	{"numeric type", `{"company":"a","type":1,"value":1,"id":1,"created_at":"2021-10-13T12:02:39Z"}`, resultInvalid, 0},
+	{"no value", `{"company":"a","type":"+","id":1,"created_at":"2021-10-13T12:02:39Z"}`, resultInvalid, 0},
+	{"fractional value", `{"company":"a","type":"+","value":1.5,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultInvalid, 0},
+	{"integral float value", `{"company":"a","type":"+","value":2.0,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultValid, 2},
+	{"fractional string value", `{"company":"a","type":"+","value":"1.5","id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultInvalid, 0},
+	{"boolean value", `{"company":"a","type":"+","value":false,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultInvalid, 0},
+	{"integral float id", `{"company":"a","type":"+","value":1,"id":1.0,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultValid, 1},
+	{"id beyond int64",
+		`{"company":"a","type":"+","value":1,"id":9223372036854775808,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+	{"exponent value", `{"company":"a","type":"+","value":1e3,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultValid, 1000},
+	{"underflowing value", `{"company":"a","type":"+","value":1e-400,"id":1,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultInvalid, 0},
+	{"invalid fields and no id", `{"company":"a","type":"?","value":1.5,"created_at":"2021-10-13T12:02:39Z"}`,
+		resultUnsupported, 0},
+}
+
+func TestCheckBill(t *testing.T) {
+	for _, tc := range checkBillCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var bill Bill
+
+			if err := json.Unmarshal([]byte(tc.bill), &bill); err != nil {
+				t.Fatal(err)
+			}
+
+			op, err := Normalize(bill)
+
+			if got := resultOf(err); got != tc.want {
+				t.Errorf("Normalize(%s) is %s, want %s", tc.bill, got, tc.want)
+			}
+
+			if op.Signed() != tc.signed {
+				t.Errorf("%s is %s %d, want %d", tc.bill, op.Direction, op.Amount, tc.signed)
+			}
+		})
+	}
+}
+
+func TestNumbersKeepPrecision(t *testing.T) {
+	cases := []struct {
+		bill   string
+		id     OperationID
+		amount int64
+	}{
+		{`{"id":1,"value":1}`, OperationID{Text: "1", Numeric: true}, 1},
+		{`{"id":1.0,"value":1.0}`, OperationID{Text: "1.0", Numeric: true}, 1},
+		{`{"id":"1","value":"1"}`, OperationID{Text: "1"}, 1},
+		{`{"id":9007199254740993,"value":9007199254740993}`, OperationID{Text: "9007199254740993", Numeric: true},
+			9007199254740993},
+		{`{"id":-0,"value":9223372036854775807}`, OperationID{Text: "-0", Numeric: true}, 9223372036854775807},
+	}
+
+	for _, tc := range cases {
+		var bill Bill
+
+		if err := json.Unmarshal([]byte(tc.bill), &bill); err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := parseID(bill.ID)
+
+		if err != nil || id != tc.id {
+			t.Errorf("id of %s is %#v (%v), want %#v", tc.bill, id, err, tc.id)
+		}
+
+		amount, err := parseValue(bill.Value)
+
+		if err != nil || amount != tc.amount {
+			t.Errorf("value of %s is %d (%v), want %d", tc.bill, amount, err, tc.amount)
+		}
+	}
+}
+
+func TestNumericIDsIdentifyOperations(t *testing.T) {
+	ops := []NormalizedOperation{
+		{Company: "a", ID: OperationID{Text: "7.0", Numeric: true}},
+		{Company: "a", ID: OperationID{Text: "7", Numeric: true}},
+		{Company: "a", ID: OperationID{Text: "7e0", Numeric: true}},
+		{Company: "a", ID: OperationID{Text: "7"}},
+		{Company: "b", ID: OperationID{Text: "7", Numeric: true}},
+	}
+
+	got, _ := Deduplicate(ops, DuplicatesKeepFirst)
+	want := []NormalizedOperation{ops[0], ops[3], ops[4]}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deduplicated operations are %v, want %v", got, want)
+	}
+
+	oldReports := []Report{{Company: "a", InvalidOperations: []OperationID{{Text: "1", Numeric: true}}}}
+	newReports := []Report{{Company: "a", InvalidOperations: []OperationID{{Text: "1.0", Numeric: true}}}}
+
+	if diffs := DiffReports(oldReports, newReports); len(diffs) != 0 {
+		t.Errorf("diff of the same invalid operation is %+v, want none", diffs)
+	}
+}
+
+func readBillingFile(tb testing.TB) []byte {
+	tb.Helper()
+
+	data, err := os.ReadFile(billingFile)
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return data
+}
+
+func TestBillingFile(t *testing.T) {
+	var raw []json.RawMessage
+
+	if err := json.Unmarshal(readBillingFile(t), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+
+	for i, data := range raw {
+		var bill Bill
+
+		if err := json.Unmarshal(data, &bill); err != nil {
+			t.Fatalf("bill %d: %v", i+1, err)
+		}
+
+		counts[resultOf(checkBill(bill))]++
+	}
+
+	want := map[string]int{resultValid: 26, resultInvalid: 5, resultUnsupported: 19}
+
+	for result, count := range want {
+		if counts[result] != count {
+			t.Errorf("%d %s bills, want %d (all counts: %v)", counts[result], result, count, counts)
+		}
+	}
+}
+
+func TestMakeReportsMatchesOutFile(t *testing.T) {
+	bills, err := ReadBills(bytes.NewReader(readBillingFile(t)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile("../out.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+
+	if err = EncodeReports(&got, MakeReports(bills)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The golden file is indented with spaces, the reports with tabs: only the indentation is normalized.
+	var compactGot, compactWant bytes.Buffer
+
+	if err = json.Compact(&compactGot, got.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = json.Compact(&compactWant, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(compactGot.Bytes(), compactWant.Bytes()) {
+		t.Errorf("reports are\n%s\nwant\n%s", got.Bytes(), data)
+	}
+}
@@ -0,0 +1,264 @@
+package bill
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Kinds of report flags.
+const (
+	FlagLowBalance   = "low_balance"
+	FlagOutlier      = "outlier"
+	FlagInvalidBurst = "invalid_burst"
+)
+
+// AlertsSuffix ends the name of the alerts section written next to the report.
+const AlertsSuffix = ".alerts.json"
+
+// defaultBurstCount is the number of invalid operations in a burst if the config does not set it.
+const defaultBurstCount = 3
+
+// Flag marks a report that needs attention.
+type Flag struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Alert lists the flags of a company.
+type Alert struct {
+	Company string `json:"company"`
+	Flags   []Flag `json:"flags"`
+}
+
+// AlertConfig sets up the flags of reports, a check is off if its parameter is not set.
+type AlertConfig struct {
+	// MinBalance flags the companies whose balance is below it.
+	MinBalance *int64
+	// MaxDeviations flags the valid operations whose signed value is farther than this number of standard deviations
+	// from the mean of the company.
+	MaxDeviations float64
+	// BurstCount invalid operations of a company created within BurstWindow are flagged as a burst.
+	BurstCount  int
+	BurstWindow time.Duration
+}
+
+// alertFile is the alert config file (.json format).
+type alertFile struct {
+	MinBalance    *int64  `json:"min_balance"`
+	MaxDeviations float64 `json:"max_deviations"`
+	InvalidBurst  *struct {
+		Count  int    `json:"count"`
+		Window string `json:"window"`
+	} `json:"invalid_burst"`
+}
+
+// LoadAlertConfig reads the alert config file (.json format), e.g.
+// {"min_balance": 0, "max_deviations": 3, "invalid_burst": {"count": 3, "window": "1h"}}.
+func LoadAlertConfig(fileName string) (*AlertConfig, error) {
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var file alertFile
+
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	if file.MaxDeviations < 0 {
+		return nil, InvalidInputError{msg: "\"max_deviations\" must not be negative"}
+	}
+
+	config := &AlertConfig{MinBalance: file.MinBalance, MaxDeviations: file.MaxDeviations}
+
+	if burst := file.InvalidBurst; burst != nil {
+		if config.BurstWindow, err = time.ParseDuration(burst.Window); err != nil || config.BurstWindow <= 0 {
+			return nil, InvalidInputError{msg: "\"invalid_burst\" requires a positive \"window\" such as \"1h\""}
+		}
+
+		config.BurstCount = burst.Count
+
+		if config.BurstCount == 0 {
+			config.BurstCount = defaultBurstCount
+		}
+
+		if config.BurstCount < 2 {
+			return nil, InvalidInputError{msg: "\"count\" of \"invalid_burst\" must be at least 2"}
+		}
+	}
+
+	return config, nil
+}
+
+// Flag sets the flags of the reports on the operations (in the time range of the reports).
+func (c AlertConfig) Flag(reports []Report, ops []NormalizedOperation) {
+	byCompany := map[string][]NormalizedOperation{}
+
+	for _, op := range ops {
+		byCompany[op.Company] = append(byCompany[op.Company], op)
+	}
+
+	for i := range reports {
+		report := &reports[i]
+		companyOps := byCompany[report.Company]
+
+		if c.MinBalance != nil && report.Balance < *c.MinBalance {
+			report.Flags = append(report.Flags, Flag{
+				Kind:    FlagLowBalance,
+				Message: fmt.Sprintf("balance %d is below %d", report.Balance, *c.MinBalance),
+			})
+		}
+
+		if c.MaxDeviations > 0 {
+			report.Flags = append(report.Flags, c.outliers(companyOps)...)
+		}
+
+		if c.BurstCount > 0 {
+			report.Flags = append(report.Flags, c.bursts(companyOps)...)
+		}
+	}
+}
+
+// outliers flags the valid operations too far from the mean.
+func (c AlertConfig) outliers(ops []NormalizedOperation) []Flag {
+	var values []float64
+
+	for _, op := range ops {
+		if op.Valid() {
+			values = append(values, float64(op.Signed()))
+		}
+	}
+
+	if len(values) < 2 {
+		return nil
+	}
+
+	var sum float64
+
+	for _, value := range values {
+		sum += value
+	}
+
+	mean := sum / float64(len(values))
+	var squares float64
+
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+
+	deviation := math.Sqrt(squares / float64(len(values)))
+
+	if deviation == 0 {
+		return nil
+	}
+
+	var flags []Flag
+
+	for _, op := range ops {
+		if !op.Valid() {
+			continue
+		}
+
+		if distance := math.Abs(float64(op.Signed())-mean) / deviation; distance > c.MaxDeviations {
+			flags = append(flags, Flag{
+				Kind: FlagOutlier,
+				Message: fmt.Sprintf("operation %v with value %d is %.1f standard deviations from the mean %.1f",
+					op.ID, op.Signed(), distance, mean),
+			})
+		}
+	}
+
+	return flags
+}
+
+// bursts flags the series of invalid operations created within the window, each series is flagged once.
+func (c AlertConfig) bursts(ops []NormalizedOperation) []Flag {
+	var times []time.Time
+
+	for _, op := range ops {
+		if !op.Valid() {
+			times = append(times, op.CreatedAt)
+		}
+	}
+
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+
+	var flags []Flag
+
+	for start := 0; start+c.BurstCount <= len(times); {
+		end := start + c.BurstCount
+
+		if times[end-1].Sub(times[start]) > c.BurstWindow {
+			start++
+
+			continue
+		}
+
+		for end < len(times) && times[end].Sub(times[start]) <= c.BurstWindow {
+			end++
+		}
+
+		flags = append(flags, Flag{
+			Kind: FlagInvalidBurst,
+			Message: fmt.Sprintf("%d invalid operations within %v from %s",
+				end-start, c.BurstWindow, times[start].Format(time.RFC3339)),
+		})
+		start = end
+	}
+
+	return flags
+}
+
+// Alerts returns the flagged companies in the order of the reports.
+func Alerts(reports []Report) []Alert {
+	alerts := []Alert{}
+
+	for _, report := range reports {
+		if len(report.Flags) != 0 {
+			alerts = append(alerts, Alert{Company: report.Company, Flags: report.Flags})
+		}
+	}
+
+	return alerts
+}
+
+var alertsFileArg = flag.String("alerts-file", "",
+	"File of alert thresholds (.json format): flags low balances, outlying operations and bursts of invalid ones, "+
+		"the alerts section is written to the output file name plus \""+AlertsSuffix+"\"")
+
+// GetAlertConfig loads the alert config from the file passed in --alerts-file or ENV ALERTS_FILE (in order of
+// priority), nil if no file is passed.
+func GetAlertConfig() (*AlertConfig, error) {
+	parseFlags()
+	fileName := flagOrEnv(*alertsFileArg, "ALERTS_FILE")
+
+	if fileName == "" {
+		return nil, nil
+	}
+
+	return LoadAlertConfig(fileName)
+}
+
+// WriteAlerts writes the alerts section (.json format) next to the report of the output: to the output file name plus
+// AlertsSuffix, signed as the report. The section is written even if there are no alerts, so a missing section is
+// not mistaken for a clean report.
+func WriteAlerts(alerts []Alert, output Output) error {
+	output.FileName += AlertsSuffix
+
+	return output.Write(func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+
+		return encoder.Encode(alerts)
+	})
+}
@@ -0,0 +1,169 @@
+package bill
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Steps of company name normalization.
+const (
+	// NormalizeTrim removes the leading and trailing spaces.
+	NormalizeTrim = "trim"
+	// NormalizeCase folds the case.
+	NormalizeCase = "case"
+	// NormalizeUnicode applies NFKC normalization (composed and compatibility forms, so "e\u0301" is "é" and
+	// fullwidth letters are ASCII ones), removes invisible format characters (zero-width spaces, BOM) and replaces
+	// every run of Unicode spaces with a single space.
+	NormalizeUnicode = "unicode"
+)
+
+// CompanyNames turns the variants of company names into the canonical names before aggregation.
+type CompanyNames struct {
+	Trim     bool
+	FoldCase bool
+	Unicode  bool
+	// Aliases maps the normalized variants of names to the canonical names.
+	Aliases map[string]string
+}
+
+// ParseCompanyNormalization parses the comma-separated steps of normalization.
+func ParseCompanyNormalization(str string) (CompanyNames, error) {
+	var names CompanyNames
+
+	for _, step := range strings.Split(str, ",") {
+		switch strings.ToLower(strings.TrimSpace(step)) {
+		case "":
+		case NormalizeTrim:
+			names.Trim = true
+		case NormalizeCase:
+			names.FoldCase = true
+		case NormalizeUnicode:
+			names.Unicode = true
+		default:
+			return CompanyNames{}, InvalidInputError{
+				msg: "company normalization can only consist of the steps: \"trim\", \"case\", \"unicode\"",
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// LoadAliases reads the alias file (.json format): an object mapping each canonical company name to the list of its
+// variants. The variants are matched after normalization.
+func (n *CompanyNames) LoadAliases(fileName string) error {
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	var file map[string][]string
+
+	if err = json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	n.Aliases = map[string]string{}
+
+	for canonical, variants := range file {
+		for _, variant := range append([]string{canonical}, variants...) {
+			key := n.normalize(variant)
+
+			if other, ok := n.Aliases[key]; ok && other != canonical {
+				return InvalidInputError{
+					msg: "company \"" + variant + "\" is an alias of both \"" + other + "\" and \"" + canonical + "\"",
+				}
+			}
+
+			n.Aliases[key] = canonical
+		}
+	}
+
+	return nil
+}
+
+// Canonical returns the canonical name of the company.
+func (n CompanyNames) Canonical(company string) string {
+	company = n.normalize(company)
+
+	if canonical, ok := n.Aliases[company]; ok {
+		return canonical
+	}
+
+	return company
+}
+
+func (n CompanyNames) normalize(company string) string {
+	if n.Unicode {
+		company = normalizeUnicode(company)
+	}
+
+	if n.Trim {
+		company = strings.TrimSpace(company)
+	}
+
+	if n.FoldCase {
+		company = strings.ToLower(strings.ToUpper(company))
+	}
+
+	return company
+}
+
+// normalizeUnicode applies NormalizeUnicode to the string.
+func normalizeUnicode(str string) string {
+	var builder strings.Builder
+	space := false
+
+	for _, r := range norm.NFKC.String(str) {
+		switch {
+		case unicode.Is(unicode.Cf, r):
+			continue
+		case unicode.IsSpace(r):
+			if !space {
+				builder.WriteRune(' ')
+			}
+
+			space = true
+
+			continue
+		}
+
+		builder.WriteRune(r)
+		space = false
+	}
+
+	return builder.String()
+}
+
+var (
+	companyNormalizeArg = flag.String("company-normalize", "",
+		"Comma-separated steps of company name normalization: trim, case, unicode")
+	companyAliasesArg = flag.String("company-aliases", "",
+		"File mapping canonical company names to their variants (.json format)")
+)
+
+// GetCompanyNames returns the normalization of company names passed in --company-normalize and --company-aliases or
+// ENV COMPANY_NORMALIZE and COMPANY_ALIASES (in order of priority).
+func GetCompanyNames() (CompanyNames, error) {
+	parseFlags()
+
+	names, err := ParseCompanyNormalization(flagOrEnv(*companyNormalizeArg, "COMPANY_NORMALIZE"))
+
+	if err != nil {
+		return CompanyNames{}, err
+	}
+
+	if fileName := flagOrEnv(*companyAliasesArg, "COMPANY_ALIASES"); fileName != "" {
+		if err = names.LoadAliases(fileName); err != nil {
+			return CompanyNames{}, err
+		}
+	}
+
+	return names, nil
+}
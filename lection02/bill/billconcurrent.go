@@ -0,0 +1,134 @@
+package bill
+
+import (
+	"flag"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// minChunkSize is the smallest number of items handed to a worker at once, smaller inputs are split into fewer chunks.
+const minChunkSize = 1024
+
+// chunks splits n items into at most workers*4 contiguous ranges, so faster workers take more of them.
+func chunks(n, workers int) [][2]int {
+	size := n / (workers * 4)
+
+	if size < minChunkSize {
+		size = minChunkSize
+	}
+
+	var ranges [][2]int
+
+	for start := 0; start < n; start += size {
+		end := start + size
+
+		if end > n {
+			end = n
+		}
+
+		ranges = append(ranges, [2]int{start, end})
+	}
+
+	return ranges
+}
+
+// runPool calls the job for each chunk index in a pool of workers and waits for all of them.
+func runPool(workers, jobs int, job func(i int)) {
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+
+	if workers > jobs {
+		workers = jobs
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				job(i)
+			}
+		}()
+	}
+
+	for i := 0; i < jobs; i++ {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+}
+
+// normalizeConcurrently normalizes chunks of bills in a pool of workers and joins the results in the order of input,
+// so the operations are the same as after sequential normalization.
+func (p Processor) normalizeConcurrently(bills []Bill) ([]NormalizedOperation, Stats) {
+	ranges := chunks(len(bills), p.Workers)
+	partOps := make([][]NormalizedOperation, len(ranges))
+	partStats := make([]Stats, len(ranges))
+
+	runPool(p.Workers, len(ranges), func(i int) {
+		partOps[i], partStats[i] = p.normalizeChunk(bills[ranges[i][0]:ranges[i][1]])
+	})
+
+	var stats Stats
+	size := 0
+
+	for i := range ranges {
+		stats = stats.Add(partStats[i])
+		size += len(partOps[i])
+	}
+
+	ops := make([]NormalizedOperation, 0, size)
+
+	for _, part := range partOps {
+		ops = append(ops, part...)
+	}
+
+	return ops, stats
+}
+
+// aggregateConcurrently aggregates chunks of operations in a pool of workers and merges the partial aggregates in
+// the order of input, so the reports are the same as after sequential aggregation.
+func aggregateConcurrently(ops []NormalizedOperation, workers int) []Report {
+	ranges := chunks(len(ops), workers)
+	parts := make([]aggregates, len(ranges))
+
+	runPool(workers, len(ranges), func(i int) {
+		parts[i] = aggregates{}
+		parts[i].add(ops[ranges[i][0]:ranges[i][1]])
+	})
+
+	aggs := aggregates{}
+
+	for _, part := range parts {
+		aggs.merge(part)
+	}
+
+	return aggs.reports()
+}
+
+var workersArg = flag.String("workers", "",
+	"Number of goroutines validating bills, \"auto\" means the number of CPUs (sequential by default)")
+
+// GetWorkers returns the number of workers passed in --workers or ENV WORKERS (in order of priority).
+func GetWorkers() (int, error) {
+	parseFlags()
+
+	switch value := flagOrEnv(*workersArg, "WORKERS"); value {
+	case "":
+		return 1, nil
+	case "auto":
+		return runtime.GOMAXPROCS(0), nil
+	default:
+		workers, err := strconv.Atoi(value)
+
+		if err != nil || workers < 1 {
+			return 0, InvalidInputError{msg: "number of workers must be a positive integer or \"auto\""}
+		}
+
+		return workers, nil
+	}
+}
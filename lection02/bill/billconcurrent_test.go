@@ -0,0 +1,130 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// syntheticBills generates n bills of different shapes, including invalid and unsupported ones.
+func syntheticBills(tb testing.TB, n int) []Bill {
+	tb.Helper()
+
+	return randomBills(tb, rand.New(rand.NewSource(1)), n)
+}
+
+// randomBills generates n bills of different shapes with the random source.
+func randomBills(tb testing.TB, random *rand.Rand, n int) []Bill {
+	tb.Helper()
+
+	companies := [...]string{"hoofs", "horns", "tails", "manes", "paws"}
+	types := [...]interface{}{"income", "outcome", "+", "-", "refund", 1}
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	raw := make([]map[string]interface{}, 0, n)
+
+	for i := 0; i < n; i++ {
+		body := map[string]interface{}{
+			"type":  types[random.Intn(len(types))],
+			"value": random.Intn(2000) - 1000,
+			"id":    i,
+		}
+
+		switch random.Intn(4) {
+		case 0:
+			body["value"] = strconv.Itoa(random.Intn(1000))
+		case 1:
+			body["id"] = fmt.Sprintf("op-%d", i)
+		case 2:
+			body["value"] = random.Float64() * 100
+		}
+
+		createdAt := start.Add(time.Duration(random.Intn(365*24)) * time.Hour).Format(time.RFC3339)
+		bill := map[string]interface{}{"company": companies[random.Intn(len(companies))]}
+
+		if random.Intn(2) == 0 {
+			body["created_at"] = createdAt
+			bill["operation"] = body
+		} else {
+			for key, value := range body {
+				bill[key] = value
+			}
+
+			bill["created_at"] = createdAt
+		}
+
+		if random.Intn(20) == 0 {
+			delete(bill, "created_at")
+		}
+
+		raw = append(raw, bill)
+	}
+
+	data, err := json.Marshal(raw)
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	bills, err := ReadBills(bytes.NewReader(data))
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return bills
+}
+
+func encodedReports(tb testing.TB, reports []Report) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+
+	if err := EncodeReports(&buf, reports); err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestConcurrentMatchesSequential(t *testing.T) {
+	bills := syntheticBills(t, 20000)
+	sequential := DefaultProcessor()
+	expectedOps, expectedStats := sequential.NormalizeBills(bills)
+	expected := encodedReports(t, sequential.MakeReports(bills))
+
+	for _, workers := range []int{2, 3, 8} {
+		concurrent := DefaultProcessor()
+		concurrent.Workers = workers
+		ops, stats := concurrent.NormalizeBills(bills)
+
+		if stats != expectedStats || len(ops) != len(expectedOps) {
+			t.Fatalf("workers=%d: stats %v, %d operations; want %v, %d operations",
+				workers, stats, len(ops), expectedStats, len(expectedOps))
+		}
+
+		if actual := encodedReports(t, concurrent.MakeReports(bills)); !bytes.Equal(actual, expected) {
+			t.Errorf("workers=%d: reports differ from the sequential ones:\n%s\nwant:\n%s", workers, actual, expected)
+		}
+	}
+}
+
+// BenchmarkNormalizeAggregate measures the stages that run concurrently: normalization and aggregation.
+func BenchmarkNormalizeAggregate(b *testing.B) {
+	bills := syntheticBills(b, 200000)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		processor := DefaultProcessor()
+		processor.Workers = workers
+
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ops, _ := processor.NormalizeBills(bills)
+				processor.Aggregate(ops)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package bill
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Fields of a bill that are read from CSV columns.
+const (
+	FieldCompany   = "company"
+	FieldType      = "type"
+	FieldValue     = "value"
+	FieldID        = "id"
+	FieldCreatedAt = "created_at"
+	// FieldCounterparty is optional: the column may be missing.
+	FieldCounterparty = "counterparty"
+)
+
+var csvFields = [...]string{FieldCompany, FieldType, FieldValue, FieldID, FieldCreatedAt, FieldCounterparty}
+
+// CSVMapping maps the fields of a bill to the headers of CSV columns.
+type CSVMapping map[string]string
+
+// DefaultCSVMapping returns the mapping where every column header is named after its field.
+func DefaultCSVMapping() CSVMapping {
+	mapping := CSVMapping{}
+
+	for _, field := range csvFields {
+		mapping[field] = field
+	}
+
+	return mapping
+}
+
+// ParseCSVMapping parses the mapping in the "field=header,field=header" format. The fields which are not listed are
+// mapped to the headers named after them.
+func ParseCSVMapping(str string) (CSVMapping, error) {
+	mapping := DefaultCSVMapping()
+
+	if strings.TrimSpace(str) == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(str, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, InvalidInputError{msg: "CSV mapping must be in the \"field=header,...\" format"}
+		}
+
+		field := strings.TrimSpace(parts[0])
+
+		if _, ok := mapping[field]; !ok {
+			return nil, InvalidInputError{msg: "unknown field \"" + field + "\" in the CSV mapping"}
+		}
+
+		mapping[field] = strings.TrimSpace(parts[1])
+	}
+
+	return mapping, nil
+}
+
+var csvMapArg = flag.String("csv-map", "",
+	"Mapping of the bill fields to the CSV column headers: \"company=Firm,value=Amount\", "+
+		"not listed fields are read from the columns named after them")
+
+// GetCSVMapping searches for the CSV mapping (--csv-map, ENV CSV_MAP - in order of priority).
+func GetCSVMapping() (CSVMapping, error) {
+	parseFlags()
+
+	if str := FormatQuotes(*csvMapArg); str != "" {
+		return ParseCSVMapping(str)
+	}
+
+	return ParseCSVMapping(FormatQuotes(os.Getenv("CSV_MAP")))
+}
+
+// ReadCSVBills decodes the CSV statement with bills (optionally gzip-compressed). The first row contains the headers,
+// an empty cell means that the field was not passed.
+func ReadCSVBills(input io.Reader, mapping CSVMapping) ([]Bill, error) {
+	reader, err := decompress(bufio.NewReader(input))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeCSVBills(reader, mapping)
+}
+
+// decodeCSVBills decodes the decompressed CSV statement with bills.
+func decodeCSVBills(reader io.Reader, mapping CSVMapping) ([]Bill, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+
+	if err == io.EOF {
+		return nil, InvalidInputError{msg: "Statement is empty"}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := mapColumns(header, mapping)
+
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := unknownColumns(header, columns)
+	var bills []Bill
+
+	for {
+		record, err := csvReader.Read()
+
+		if err == io.EOF {
+			return bills, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		bill := csvBill(record, columns)
+
+		for _, i := range unknown {
+			if i < len(record) && strings.TrimSpace(record[i]) != "" {
+				bill.unknown = append(bill.unknown, strings.TrimSpace(header[i]))
+			}
+		}
+
+		bills = append(bills, bill)
+	}
+}
+
+// unknownColumns returns the indexes of the columns that are not mapped to any field, sorted by header.
+func unknownColumns(header []string, columns map[string]int) []int {
+	mapped := map[int]bool{}
+
+	for _, i := range columns {
+		mapped[i] = true
+	}
+
+	var unknown []int
+
+	for i := range header {
+		if !mapped[i] {
+			unknown = append(unknown, i)
+		}
+	}
+
+	sort.Slice(unknown, func(i, j int) bool {
+		return strings.TrimSpace(header[unknown[i]]) < strings.TrimSpace(header[unknown[j]])
+	})
+
+	return unknown
+}
+
+// mapColumns returns the column index for each field.
+func mapColumns(header []string, mapping CSVMapping) (map[string]int, error) {
+	indexes := map[string]int{}
+
+	for i, name := range header {
+		indexes[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	columns := map[string]int{}
+
+	for _, field := range csvFields {
+		name := mapping[field]
+		i, ok := indexes[strings.ToLower(name)]
+
+		if !ok && field == FieldCounterparty {
+			continue
+		}
+
+		if !ok {
+			return nil, InvalidInputError{msg: fmt.Sprintf("CSV column \"%s\" for the field \"%s\" was not found", name, field)}
+		}
+
+		columns[field] = i
+	}
+
+	return columns, nil
+}
+
+// csvBill converts the CSV record to the Bill with the operation in the root of the object.
+func csvBill(record []string, columns map[string]int) Bill {
+	cell := func(field string) (string, bool) {
+		i, ok := columns[field]
+
+		if !ok || i >= len(record) {
+			return "", false
+		}
+
+		str := strings.TrimSpace(record[i])
+
+		return str, str != ""
+	}
+
+	var (
+		bill      Bill
+		operation Operation
+		body      Body
+	)
+
+	if str, ok := cell(FieldCompany); ok {
+		company := Company(str)
+		bill.Company = &company
+	}
+
+	if str, ok := cell(FieldType); ok {
+		opType := Type(str)
+		body.Type = &opType
+	}
+
+	if str, ok := cell(FieldValue); ok {
+		value := Value(str)
+		body.Value = &value
+	}
+
+	if str, ok := cell(FieldID); ok {
+		id := ID(str)
+		body.ID = &id
+	}
+
+	if str, ok := cell(FieldCounterparty); ok {
+		counterparty := Company(str)
+		body.Counterparty = &counterparty
+	}
+
+	if body.Type != nil || body.Value != nil || body.ID != nil || body.Counterparty != nil {
+		operation.Body = &body
+	}
+
+	if str, ok := cell(FieldCreatedAt); ok {
+		createdAt := CreatedAt(str)
+		operation.CreatedAt = &createdAt
+	}
+
+	if operation.Body != nil || operation.CreatedAt != nil {
+		bill.Operation = &operation
+	}
+
+	return bill
+}
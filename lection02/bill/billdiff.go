@@ -0,0 +1,164 @@
+package bill
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CompanyDiff is the difference between two reports on a company. Old or New is nil if the company is missing in
+// the corresponding report.
+type CompanyDiff struct {
+	Company        string
+	Old            *Report
+	New            *Report
+	AddedInvalid   []OperationID
+	RemovedInvalid []OperationID
+}
+
+// BalanceDelta returns the change of the balance.
+func (d CompanyDiff) BalanceDelta() int64 {
+	return d.report(d.New).Balance - d.report(d.Old).Balance
+}
+
+// ValidDelta returns the change of the number of valid operations.
+func (d CompanyDiff) ValidDelta() int64 {
+	return int64(d.report(d.New).ValidOperationsCount) - int64(d.report(d.Old).ValidOperationsCount)
+}
+
+func (d CompanyDiff) report(report *Report) Report {
+	if report == nil {
+		return Report{Company: d.Company}
+	}
+
+	return *report
+}
+
+func (d CompanyDiff) String() string {
+	var parts []string
+
+	switch {
+	case d.Old == nil:
+		parts = append(parts, "added")
+	case d.New == nil:
+		parts = append(parts, "removed")
+	}
+
+	oldReport, newReport := d.report(d.Old), d.report(d.New)
+
+	if delta := d.BalanceDelta(); delta != 0 {
+		parts = append(parts, fmt.Sprintf("balance %d -> %d (%+d)", oldReport.Balance, newReport.Balance, delta))
+	}
+
+	if delta := d.ValidDelta(); delta != 0 {
+		parts = append(parts, fmt.Sprintf("valid operations %d -> %d (%+d)",
+			oldReport.ValidOperationsCount, newReport.ValidOperationsCount, delta))
+	}
+
+	if len(d.AddedInvalid) != 0 {
+		parts = append(parts, "invalid added: "+joinIDs(d.AddedInvalid))
+	}
+
+	if len(d.RemovedInvalid) != 0 {
+		parts = append(parts, "invalid removed: "+joinIDs(d.RemovedInvalid))
+	}
+
+	if len(parts) == 0 {
+		parts = append(parts, "invalid operations reordered")
+	}
+
+	return d.Company + ": " + strings.Join(parts, ", ")
+}
+
+func joinIDs(ids []OperationID) string {
+	strs := make([]string, 0, len(ids))
+
+	for _, id := range ids {
+		strs = append(strs, id.String())
+	}
+
+	return strings.Join(strs, ", ")
+}
+
+// DiffReports compares the reports and returns the differences for the companies whose reports are not equal, sorted
+// by company name.
+func DiffReports(oldReports, newReports []Report) []CompanyDiff {
+	diffs := map[string]*CompanyDiff{}
+	get := func(company string) *CompanyDiff {
+		diff, ok := diffs[company]
+
+		if !ok {
+			diff = &CompanyDiff{Company: company}
+			diffs[company] = diff
+		}
+
+		return diff
+	}
+
+	for i := range oldReports {
+		get(oldReports[i].Company).Old = &oldReports[i]
+	}
+
+	for i := range newReports {
+		get(newReports[i].Company).New = &newReports[i]
+	}
+
+	var result []CompanyDiff
+
+	for _, diff := range diffs {
+		oldReport, newReport := diff.report(diff.Old), diff.report(diff.New)
+		diff.RemovedInvalid = subtractIDs(oldReport.InvalidOperations, newReport.InvalidOperations)
+		diff.AddedInvalid = subtractIDs(newReport.InvalidOperations, oldReport.InvalidOperations)
+
+		if diff.Old != nil && diff.New != nil && diff.BalanceDelta() == 0 && diff.ValidDelta() == 0 &&
+			equalIDs(oldReport.InvalidOperations, newReport.InvalidOperations) {
+			continue
+		}
+
+		result = append(result, *diff)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Company < result[j].Company
+	})
+
+	return result
+}
+
+// subtractIDs returns the ids of a that are missing in b, taking repeated ids into account. The ids are compared by
+// their canonical form, so 1 and 1.0 are the same operation.
+func subtractIDs(a, b []OperationID) []OperationID {
+	counts := map[OperationID]int{}
+
+	for _, id := range b {
+		counts[id.canonical()]++
+	}
+
+	var result []OperationID
+
+	for _, id := range a {
+		if counts[id.canonical()] > 0 {
+			counts[id.canonical()]--
+
+			continue
+		}
+
+		result = append(result, id)
+	}
+
+	return result
+}
+
+func equalIDs(a, b []OperationID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].canonical() != b[i].canonical() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,207 @@
+package bill
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DuplicatePolicy says what to do with operations of a company that have the same id.
+type DuplicatePolicy string
+
+const (
+	// DuplicatesKeepAll counts every duplicate as a separate operation.
+	DuplicatesKeepAll DuplicatePolicy = "all"
+	// DuplicatesKeepFirst keeps the first of the duplicates in the order of input.
+	DuplicatesKeepFirst DuplicatePolicy = "first"
+	// DuplicatesKeepLatest keeps the latest of the duplicates by creation time.
+	DuplicatesKeepLatest DuplicatePolicy = "latest"
+	// DuplicatesReject makes all the duplicates invalid.
+	DuplicatesReject DuplicatePolicy = "reject"
+)
+
+// ParseDuplicatePolicy checks the name of the policy, an empty name means DuplicatesKeepAll.
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(strings.ToLower(name)); policy {
+	case "":
+		return DuplicatesKeepAll, nil
+	case DuplicatesKeepAll, DuplicatesKeepFirst, DuplicatesKeepLatest, DuplicatesReject:
+		return policy, nil
+	default:
+		return "", InvalidInputError{
+			msg: "duplicate policy can only take one of the values: \"all\", \"first\", \"latest\", \"reject\"",
+		}
+	}
+}
+
+var duplicatesArg = flag.String("duplicates", "",
+	"Policy for operations of a company with the same id: all (default), first, latest or reject")
+
+// GetDuplicatePolicy returns the policy passed in --duplicates or ENV DUPLICATES (in order of priority).
+func GetDuplicatePolicy() (DuplicatePolicy, error) {
+	parseFlags()
+
+	return ParseDuplicatePolicy(flagOrEnv(*duplicatesArg, "DUPLICATES"))
+}
+
+// IncrementalDuplicatePolicy returns the policy of incremental processing: Increment skips the operations seen before,
+// so only DuplicatesKeepFirst gives the result of a full recompute. Another policy passed in --duplicates or
+// ENV DUPLICATES is an error.
+func IncrementalDuplicatePolicy() (DuplicatePolicy, error) {
+	parseFlags()
+	name := flagOrEnv(*duplicatesArg, "DUPLICATES")
+
+	if name == "" {
+		return DuplicatesKeepFirst, nil
+	}
+
+	policy, err := ParseDuplicatePolicy(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	if policy != DuplicatesKeepFirst {
+		return "", InvalidInputError{msg: "incremental processing only supports the duplicate policy \"first\""}
+	}
+
+	return policy, nil
+}
+
+// Conflict lists the duplicates of an operation that disagree on the type or the value.
+type Conflict struct {
+	Company    string
+	ID         OperationID
+	Operations []NormalizedOperation
+}
+
+func (c Conflict) String() string {
+	variants := make([]string, 0, len(c.Operations))
+
+	for _, op := range c.Operations {
+		variant := "invalid"
+
+		if op.Valid() {
+			variant = fmt.Sprintf("%s %d", op.Direction, op.Amount)
+		}
+
+		variants = append(variants, variant+" at "+op.CreatedAt.Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("company \"%s\", id %v: %s", c.Company, c.ID, strings.Join(variants, "; "))
+}
+
+// operationKey identifies an operation of a company by the canonical id, the legs of transfers booked from other
+// companies are identified by their origin too.
+type operationKey struct {
+	company string
+	origin  string
+	id      OperationID
+}
+
+func keyOf(op NormalizedOperation) operationKey {
+	return operationKey{company: op.Company, origin: op.Origin, id: op.ID.canonical()}
+}
+
+// sameContent says whether the duplicates agree on the type and the value.
+func sameContent(a, b NormalizedOperation) bool {
+	return a.Valid() == b.Valid() && a.Direction == b.Direction && a.Amount == b.Amount
+}
+
+// Deduplicate applies the policy to the operations with the same company and id and returns the remaining operations
+// in the order of input with the conflicts between duplicates. The leg of a transfer following it (as NormalizeBills
+// returns them) is kept, dropped or rejected together with the transfer.
+func Deduplicate(ops []NormalizedOperation, policy DuplicatePolicy) ([]NormalizedOperation, []Conflict) {
+	if policy == "" {
+		policy = DuplicatesKeepAll
+	}
+
+	groups := map[operationKey][]int{}
+	var keys []operationKey
+	// transferOf maps the indexes of legs to the indexes of their transfers.
+	transferOf := map[int]int{}
+
+	for i, op := range ops {
+		if legFollows(ops, i) {
+			transferOf[i] = i - 1
+
+			continue
+		}
+
+		key := keyOf(op)
+
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		groups[key] = append(groups[key], i)
+	}
+
+	var conflicts []Conflict
+	keep := make([]bool, len(ops))
+	result := make([]NormalizedOperation, 0, len(ops))
+
+	for _, key := range keys {
+		indexes := groups[key]
+
+		// The conflicts of transfer legs are reported on the bills of their origin.
+		for _, i := range indexes[1:] {
+			if key.origin == "" && !sameContent(ops[indexes[0]], ops[i]) {
+				conflict := Conflict{Company: key.company, ID: ops[indexes[0]].ID}
+
+				for _, j := range indexes {
+					conflict.Operations = append(conflict.Operations, ops[j])
+				}
+
+				conflicts = append(conflicts, conflict)
+
+				break
+			}
+		}
+
+		switch {
+		case len(indexes) == 1 || policy == DuplicatesKeepAll || policy == DuplicatesReject:
+			for _, i := range indexes {
+				keep[i] = true
+			}
+		case policy == DuplicatesKeepFirst:
+			keep[indexes[0]] = true
+		case policy == DuplicatesKeepLatest:
+			latest := indexes[0]
+
+			for _, i := range indexes[1:] {
+				if !ops[i].CreatedAt.Before(ops[latest].CreatedAt) {
+					latest = i
+				}
+			}
+
+			keep[latest] = true
+		}
+	}
+
+	for leg, transfer := range transferOf {
+		keep[leg] = keep[transfer]
+	}
+
+	for i, op := range ops {
+		if !keep[i] {
+			continue
+		}
+
+		source := op
+
+		if transfer, ok := transferOf[i]; ok {
+			source = ops[transfer]
+		}
+
+		if policy == DuplicatesReject && len(groups[keyOf(source)]) > 1 {
+			op.Direction, op.Amount = 0, 0
+			op.Err = InvalidBill{msg: fmt.Sprintf("operation id %v is duplicated", op.ID)}
+		}
+
+		result = append(result, op)
+	}
+
+	return result, conflicts
+}
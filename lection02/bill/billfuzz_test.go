@@ -0,0 +1,189 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"testing/quick"
+)
+
+// rawSigned computes the signed value of a valid bill right from its raw body, apart from the parsing under test.
+func rawSigned(bill Bill) int64 {
+	var body *Body
+
+	if bill.Operation != nil && bill.Operation.Body != nil {
+		body = bill.Operation.Body
+	} else {
+		body = bill.OperationStruct.Body
+	}
+
+	var amount int64
+
+	switch v := (*body.Value).(type) {
+	case json.Number:
+		r, _ := new(big.Rat).SetString(v.String())
+		amount = r.Num().Int64()
+	case float64:
+		amount = int64(v)
+	case string:
+		amount, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	if t := (*body.Type).(string); t == "outcome" || t == "-" {
+		return -amount
+	}
+
+	return amount
+}
+
+// checkReports checks the invariants of the reports on the bills: reports are sorted by company, the balance is the
+// sum of the signed values of the valid operations (a transfer is booked to the counterparty with the opposite sign),
+// and the ids of invalid operations are ordered by creation time.
+func checkReports(bills []Bill, reports []Report) error {
+	type expectation struct {
+		valid   uint
+		balance int64
+		invalid []NormalizedOperation
+	}
+
+	expected := map[string]*expectation{}
+	get := func(company string) *expectation {
+		e, ok := expected[company]
+
+		if !ok {
+			e = &expectation{}
+			expected[company] = e
+		}
+
+		return e
+	}
+
+	for _, bill := range bills {
+		op, err := Normalize(bill)
+
+		if isUnsupported(err) {
+			continue
+		}
+
+		e := get(op.Company)
+
+		if !op.Valid() {
+			e.invalid = append(e.invalid, op)
+
+			continue
+		}
+
+		signed := rawSigned(bill)
+		e.valid++
+		e.balance += signed
+
+		if op.Counterparty != "" {
+			counterparty := get(op.Counterparty)
+			counterparty.valid++
+			counterparty.balance -= signed
+		}
+	}
+
+	if len(reports) != len(expected) {
+		return fmt.Errorf("%d reports on %d companies", len(reports), len(expected))
+	}
+
+	for i, report := range reports {
+		if i > 0 && reports[i-1].Company >= report.Company {
+			return fmt.Errorf("report on %q follows %q", report.Company, reports[i-1].Company)
+		}
+
+		e, ok := expected[report.Company]
+
+		if !ok {
+			return fmt.Errorf("report on %q without operations", report.Company)
+		}
+
+		if report.ValidOperationsCount != e.valid || report.Balance != e.balance {
+			return fmt.Errorf("%q: %d valid operations with balance %d, want %d with balance %d",
+				report.Company, report.ValidOperationsCount, report.Balance, e.valid, e.balance)
+		}
+
+		sort.SliceStable(e.invalid, func(i, j int) bool {
+			return e.invalid[i].CreatedAt.Before(e.invalid[j].CreatedAt)
+		})
+
+		if len(report.InvalidOperations) != len(e.invalid) {
+			return fmt.Errorf("%q: %d invalid operations, want %d",
+				report.Company, len(report.InvalidOperations), len(e.invalid))
+		}
+
+		for j, op := range e.invalid {
+			if report.InvalidOperations[j] != op.ID {
+				return fmt.Errorf("%q: invalid operation %d is %v, want %v",
+					report.Company, j, report.InvalidOperations[j], op.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestReportInvariants(t *testing.T) {
+	property := func(seed int64, size uint8) bool {
+		bills := randomBills(t, rand.New(rand.NewSource(seed)), int(size))
+
+		if err := checkReports(bills, MakeReports(bills)); err != nil {
+			t.Logf("seed %d, %d bills: %v", seed, size, err)
+
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+// FuzzReadBills decodes arbitrary statements, checks every bill and the invariants of the reports on them.
+func FuzzReadBills(f *testing.F) {
+	data := readBillingFile(f)
+	f.Add(data)
+
+	var raw []json.RawMessage
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		f.Fatal(err)
+	}
+
+	// Every bill of the task as an NDJSON statement.
+	for _, bill := range raw {
+		f.Add([]byte(bill))
+	}
+
+	for _, tc := range checkBillCases {
+		f.Add([]byte(tc.bill))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bills, err := ReadBills(bytes.NewReader(data))
+
+		if err != nil {
+			return
+		}
+
+		for i, bill := range bills {
+			switch err := checkBill(bill); err.(type) {
+			case nil, InvalidBill, UnsupportedBill:
+			default:
+				t.Fatalf("bill %d: unexpected error %T: %v", i+1, err, err)
+			}
+		}
+
+		if err = checkReports(bills, MakeReports(bills)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
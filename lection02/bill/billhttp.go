@@ -0,0 +1,324 @@
+package bill
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxRequestSize is the default limit of the statement size in a request.
+const DefaultMaxRequestSize = 10 << 20
+
+// Media types of reports.
+const (
+	MediaJSON   = "application/json"
+	MediaNDJSON = "application/x-ndjson"
+	MediaCSV    = "text/csv"
+)
+
+// reportEncoders encode reports in the supported media types.
+var reportEncoders = map[string]func(w io.Writer, reports []Report) error{
+	MediaJSON:   EncodeReports,
+	MediaNDJSON: encodeReportsNDJSON,
+	MediaCSV:    encodeReportsCSV,
+}
+
+// Handler is the HTTP service that processes statements: POST /reports returns the report on the statement in the
+// request body (JSON array, NDJSON or CSV, optionally gzip-compressed) in the media type chosen by the Accept header.
+type Handler struct {
+	Processor Processor
+	CSV       CSVMapping
+	// MaxSize limits the size of the request body and of the decompressed statement, DefaultMaxRequestSize if not
+	// set.
+	MaxSize int64
+	// Logger receives a line per request, no logging if not set.
+	Logger *log.Logger
+}
+
+// httpError is an error with an HTTP status.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e httpError) Error() string {
+	return e.msg
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	stats, err := h.serve(w, r)
+	status := http.StatusOK
+
+	if err != nil {
+		status = http.StatusInternalServerError
+
+		if e, ok := err.(httpError); ok {
+			status = e.status
+		}
+
+		w.Header().Set("Content-Type", MediaJSON)
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+
+	if h.Logger == nil {
+		return
+	}
+
+	if err != nil {
+		h.Logger.Printf("%s %s %d %v (%v)", r.Method, r.URL.Path, status, err, time.Since(start))
+	} else {
+		h.Logger.Printf("%s %s %d %v (%v)", r.Method, r.URL.Path, status, stats, time.Since(start))
+	}
+}
+
+// serve processes the request and writes the report if there are no errors.
+func (h Handler) serve(w http.ResponseWriter, r *http.Request) (Stats, error) {
+	if r.URL.Path != "/reports" {
+		return Stats{}, httpError{status: http.StatusNotFound, msg: "not found"}
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+
+		return Stats{}, httpError{status: http.StatusMethodNotAllowed, msg: "method not allowed"}
+	}
+
+	mediaType, ok := negotiate(r.Header.Get("Accept"))
+
+	if !ok {
+		return Stats{}, httpError{
+			status: http.StatusNotAcceptable,
+			msg:    "report can only be returned as " + MediaJSON + ", " + MediaNDJSON + " or " + MediaCSV,
+		}
+	}
+
+	format, err := requestFormat(r.Header.Get("Content-Type"))
+
+	if err != nil {
+		return Stats{}, err
+	}
+
+	body, err := h.readBody(r)
+
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var bills []Bill
+
+	if format == FormatCSV {
+		mapping := h.CSV
+
+		if mapping == nil {
+			mapping = DefaultCSVMapping()
+		}
+
+		bills, err = decodeCSVBills(bytes.NewReader(body), mapping)
+	} else {
+		bills, err = decodeBills(bufio.NewReader(bytes.NewReader(body)))
+	}
+
+	if err != nil {
+		return Stats{}, httpError{status: http.StatusBadRequest, msg: "malformed statement: " + err.Error()}
+	}
+
+	ops, stats := h.Processor.NormalizeBills(bills)
+	ops, _ = h.Processor.Deduplicate(ops)
+	reports := h.Processor.Aggregate(ops)
+
+	if err = h.Processor.CheckTransfers(reports, ops); err != nil {
+		return stats, httpError{status: http.StatusUnprocessableEntity, msg: err.Error()}
+	}
+
+	var buf bytes.Buffer
+
+	if err = reportEncoders[mediaType](&buf, reports); err != nil {
+		return stats, err
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", mediaType)
+	header.Set("X-Bills-Total", strconv.Itoa(stats.Bills))
+	header.Set("X-Bills-Valid", strconv.Itoa(stats.Valid))
+	header.Set("X-Bills-Invalid", strconv.Itoa(stats.Invalid))
+	header.Set("X-Bills-Unsupported", strconv.Itoa(stats.Unsupported))
+	_, err = w.Write(buf.Bytes())
+
+	return stats, err
+}
+
+// readBody reads the request body up to the size limit and decompresses it, the decompressed statement is limited too.
+func (h Handler) readBody(r *http.Request) ([]byte, error) {
+	maxSize := h.MaxSize
+
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRequestSize
+	}
+
+	if r.ContentLength > maxSize {
+		return nil, h.tooLarge(maxSize)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+
+	if err != nil {
+		return nil, httpError{status: http.StatusBadRequest, msg: "cannot read the request body: " + err.Error()}
+	}
+
+	if int64(len(body)) > maxSize {
+		return nil, h.tooLarge(maxSize)
+	}
+
+	if len(body) == 0 {
+		return nil, httpError{status: http.StatusBadRequest, msg: "statement is empty"}
+	}
+
+	reader, err := decompress(bufio.NewReader(bytes.NewReader(body)))
+
+	if err != nil {
+		return nil, httpError{status: http.StatusBadRequest, msg: "malformed statement: " + err.Error()}
+	}
+
+	statement, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+
+	if err != nil {
+		return nil, httpError{status: http.StatusBadRequest, msg: "malformed statement: " + err.Error()}
+	}
+
+	if int64(len(statement)) > maxSize {
+		return nil, h.tooLarge(maxSize)
+	}
+
+	return statement, nil
+}
+
+func (h Handler) tooLarge(maxSize int64) error {
+	return httpError{
+		status: http.StatusRequestEntityTooLarge,
+		msg:    fmt.Sprintf("statement must not be larger than %d bytes", maxSize),
+	}
+}
+
+// requestFormat returns the format of the statement by the Content-Type header, JSON if it is not set.
+func requestFormat(contentType string) (Format, error) {
+	if contentType == "" {
+		return FormatJSON, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return "", httpError{status: http.StatusBadRequest, msg: "malformed Content-Type: " + err.Error()}
+	}
+
+	switch mediaType {
+	// Compression and NDJSON are detected by the content, so generic types are accepted as well. The form type is what
+	// command-line clients send by default.
+	case MediaJSON, MediaNDJSON, "application/jsonl", "application/gzip", "application/octet-stream", "text/plain",
+		"application/x-www-form-urlencoded":
+		return FormatJSON, nil
+	case MediaCSV:
+		return FormatCSV, nil
+	default:
+		return "", httpError{status: http.StatusUnsupportedMediaType, msg: "unsupported statement type " + mediaType}
+	}
+}
+
+// negotiate chooses the media type of the report by the Accept header, JSON is preferred when several fit.
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaJSON, true
+	}
+
+	best, bestQuality := "", 0.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		for _, candidate := range [...]string{MediaJSON, MediaNDJSON, MediaCSV} {
+			if quality > bestQuality && mediaMatches(mediaType, candidate) {
+				best, bestQuality = candidate, quality
+			}
+		}
+	}
+
+	return best, best != ""
+}
+
+// mediaMatches says whether the media range of the Accept header matches the media type.
+func mediaMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+
+	return strings.HasSuffix(mediaRange, "/*") &&
+		strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// encodeReportsNDJSON writes a report per line.
+func encodeReportsNDJSON(w io.Writer, reports []Report) error {
+	encoder := json.NewEncoder(w)
+
+	for _, report := range reports {
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeReportsCSV writes a report per row, the ids of invalid operations are separated with spaces.
+func encodeReportsCSV(w io.Writer, reports []Report) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"company", "valid_operations_count", "balance", "invalid_operations"}); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		ids := make([]string, 0, len(report.InvalidOperations))
+
+		for _, id := range report.InvalidOperations {
+			ids = append(ids, id.Text)
+		}
+
+		err := writer.Write([]string{
+			report.Company,
+			strconv.FormatUint(uint64(report.ValidOperationsCount), 10),
+			strconv.FormatInt(report.Balance, 10),
+			strings.Join(ids, " "),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,244 @@
+package bill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// InvalidOperation is an invalid operation remembered to keep the ids of invalid operations sorted by creation time.
+type InvalidOperation struct {
+	ID        OperationID `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// CompanyState is what incremental processing knows about the processed operations of a company.
+type CompanyState struct {
+	Seen []OperationID `json:"seen"`
+	// Received are the ids of the transfer legs booked from other companies by the company of their bill.
+	Received map[string][]OperationID `json:"received,omitempty"`
+	Invalid  []InvalidOperation       `json:"invalid,omitempty"`
+}
+
+// State is the state of incremental processing saved between runs together with the report.
+type State struct {
+	Companies map[string]*CompanyState `json:"companies"`
+}
+
+// ReadReports decodes the report (.json format).
+func ReadReports(input io.Reader) ([]Report, error) {
+	var reports []Report
+
+	if err := json.NewDecoder(input).Decode(&reports); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// LoadReports reads the report file, a missing file means an empty report.
+func LoadReports(fileName string) ([]Report, error) {
+	file, err := os.Open(fileName)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer DeferClose(file)
+
+	return ReadReports(file)
+}
+
+// LoadState reads the state file (.json format), a missing file means an empty state.
+func LoadState(fileName string) (State, error) {
+	state := State{Companies: map[string]*CompanyState{}}
+	data, err := os.ReadFile(fileName)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return State{}, err
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return State{}, err
+	}
+
+	if state.Companies == nil {
+		state.Companies = map[string]*CompanyState{}
+	}
+
+	return state, nil
+}
+
+// WriteState writes the state to the output (.json format).
+func WriteState(state State, output Output) error {
+	return output.Write(func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+
+		return encoder.Encode(state)
+	})
+}
+
+// Increment applies the operations whose ids have not been seen yet to the previous report and returns the new
+// report with the new state. Operations seen before, including earlier ones of the same batch, are skipped, so the
+// result is the same as a full recompute with the DuplicatesKeepFirst policy.
+func Increment(previous []Report, state State, ops []NormalizedOperation) ([]Report, State, error) {
+	reports := map[string]Report{}
+
+	for _, report := range previous {
+		if report.Periods != nil {
+			return nil, State{}, InvalidInputError{msg: "reports with a period breakdown cannot be processed incrementally"}
+		}
+
+		// Flags are not kept up to date incrementally.
+		report.Flags = nil
+		reports[report.Company] = report
+	}
+
+	companies := map[string]*CompanyState{}
+	seen := map[operationKey]bool{}
+
+	for company, companyState := range state.Companies {
+		if err := checkState(company, reports[company], companyState); err != nil {
+			return nil, State{}, err
+		}
+
+		companies[company] = &CompanyState{
+			Seen:    append([]OperationID{}, companyState.Seen...),
+			Invalid: append([]InvalidOperation{}, companyState.Invalid...),
+		}
+
+		for _, id := range companyState.Seen {
+			seen[operationKey{company: company, id: id.canonical()}] = true
+		}
+
+		for origin, ids := range companyState.Received {
+			companies[company].setReceived(origin, append([]OperationID{}, ids...))
+
+			for _, id := range ids {
+				seen[operationKey{company: company, origin: origin, id: id.canonical()}] = true
+			}
+		}
+	}
+
+	for company := range reports {
+		if _, ok := companies[company]; !ok {
+			return nil, State{}, InvalidInputError{msg: "company \"" + company + "\" of the report is missing in the state"}
+		}
+	}
+
+	touched := map[string]bool{}
+	// skipped says whether the previous operation was seen before, the leg of a transfer is skipped with it.
+	skipped := false
+
+	for i, op := range ops {
+		key := keyOf(op)
+
+		if !legFollows(ops, i) {
+			skipped = seen[key]
+		}
+
+		if skipped {
+			continue
+		}
+
+		seen[key] = true
+		companyState, ok := companies[op.Company]
+
+		if !ok {
+			companyState = &CompanyState{}
+			companies[op.Company] = companyState
+		}
+
+		if op.Origin != "" {
+			companyState.setReceived(op.Origin, append(companyState.Received[op.Origin], op.ID))
+		} else {
+			companyState.Seen = append(companyState.Seen, op.ID)
+		}
+
+		report := reports[op.Company]
+		report.Company = op.Company
+
+		if op.Valid() {
+			report.ValidOperationsCount++
+			report.Balance += op.Signed()
+		} else {
+			companyState.Invalid = append(companyState.Invalid, InvalidOperation{ID: op.ID, CreatedAt: op.CreatedAt})
+			touched[op.Company] = true
+		}
+
+		reports[op.Company] = report
+	}
+
+	result := make([]Report, 0, len(reports))
+
+	for company, report := range reports {
+		// A new company without invalid operations gets an empty list.
+		if touched[company] || report.InvalidOperations == nil {
+			invalid := companies[company].Invalid
+			sortInvalid(invalid)
+
+			report.InvalidOperations = make([]OperationID, 0, len(invalid))
+
+			for _, op := range invalid {
+				report.InvalidOperations = append(report.InvalidOperations, op.ID)
+			}
+		}
+
+		result = append(result, report)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Company < result[j].Company
+	})
+
+	return result, State{Companies: companies}, nil
+}
+
+// checkState checks that the state of the company matches its report.
+func checkState(company string, report Report, companyState *CompanyState) error {
+	mismatch := InvalidInputError{msg: fmt.Sprintf("state of the company \"%s\" does not match the report", company)}
+
+	if len(report.InvalidOperations) != len(companyState.Invalid) {
+		return mismatch
+	}
+
+	for i, id := range report.InvalidOperations {
+		if companyState.Invalid[i].ID != id {
+			return mismatch
+		}
+	}
+
+	seen := len(companyState.Seen)
+
+	for _, ids := range companyState.Received {
+		seen += len(ids)
+	}
+
+	if uint(seen) != report.ValidOperationsCount+uint(len(companyState.Invalid)) {
+		return mismatch
+	}
+
+	return nil
+}
+
+// setReceived sets the ids of the legs received from the company.
+func (s *CompanyState) setReceived(origin string, ids []OperationID) {
+	if s.Received == nil {
+		s.Received = map[string][]OperationID{}
+	}
+
+	s.Received[origin] = ids
+}
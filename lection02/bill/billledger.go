@@ -0,0 +1,96 @@
+package bill
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// LedgerEntry is a valid operation with the balance of the company after it.
+type LedgerEntry struct {
+	ID        OperationID `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Type      Direction   `json:"type"`
+	Value     int64       `json:"value"`
+	// Counterparty is the other company of a transfer.
+	Counterparty string `json:"counterparty,omitempty"`
+	Balance      int64  `json:"balance"`
+}
+
+// Ledger is the chronological list of the valid operations of a company. OpeningBalance is the balance before the
+// first entry, which is not zero if earlier operations are out of the time range.
+type Ledger struct {
+	Company        string        `json:"company"`
+	OpeningBalance int64         `json:"opening_balance"`
+	ClosingBalance int64         `json:"closing_balance"`
+	Entries        []LedgerEntry `json:"entries"`
+}
+
+// MakeLedgers builds a ledger for each company on the valid operations in the range. Ledgers are sorted by company
+// name, entries are sorted by creation time (operations created at the same time keep the order of input).
+func MakeLedgers(ops []NormalizedOperation, r TimeRange) []Ledger {
+	byCompany := map[string][]NormalizedOperation{}
+
+	for _, op := range ops {
+		if op.Valid() {
+			byCompany[op.Company] = append(byCompany[op.Company], op)
+		}
+	}
+
+	ledgers := make([]Ledger, 0, len(byCompany))
+
+	for company, companyOps := range byCompany {
+		sort.SliceStable(companyOps, func(i, j int) bool {
+			return companyOps[i].CreatedAt.Before(companyOps[j].CreatedAt)
+		})
+
+		ledger := Ledger{Company: company, Entries: []LedgerEntry{}}
+
+		for _, op := range companyOps {
+			switch {
+			case !r.From.IsZero() && op.CreatedAt.Before(r.From):
+				ledger.OpeningBalance += op.Signed()
+				ledger.ClosingBalance = ledger.OpeningBalance
+			case r.Contains(op.CreatedAt):
+				ledger.ClosingBalance += op.Signed()
+				ledger.Entries = append(ledger.Entries, LedgerEntry{
+					ID:           op.ID,
+					CreatedAt:    op.CreatedAt,
+					Type:         op.Direction,
+					Value:        op.Amount,
+					Counterparty: op.Counterparty,
+					Balance:      ledger.ClosingBalance,
+				})
+			}
+		}
+
+		ledgers = append(ledgers, ledger)
+	}
+
+	sort.Slice(ledgers, func(i, j int) bool {
+		return ledgers[i].Company < ledgers[j].Company
+	})
+
+	return ledgers
+}
+
+// Ledgers builds the ledgers on the operations in the range of the processor.
+func (p Processor) Ledgers(ops []NormalizedOperation) []Ledger {
+	return MakeLedgers(ops, p.Range)
+}
+
+// WriteLedgers writes the ledgers to the output (.json format).
+func WriteLedgers(ledgers []Ledger, output Output) error {
+	return output.Write(func(w io.Writer) error {
+		return EncodeLedgers(w, ledgers)
+	})
+}
+
+// EncodeLedgers writes the ledgers to the stream (.json format indented with tabs).
+func EncodeLedgers(w io.Writer, ledgers []Ledger) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+
+	return encoder.Encode(ledgers)
+}
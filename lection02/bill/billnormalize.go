@@ -0,0 +1,250 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Direction is the direction of the money flow of an operation.
+type Direction int
+
+const (
+	Income Direction = iota + 1
+	Outcome
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Income:
+		return "income"
+	case Outcome:
+		return "outcome"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText writes the direction as "income" or "outcome".
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText reads the direction from "income", "outcome", "+" or "-".
+func (d *Direction) UnmarshalText(text []byte) error {
+	direction, ok := StrictProfile().direction(string(text))
+
+	if !ok {
+		return InvalidInputError{msg: "direction can only take one of the values: \"income\", \"outcome\", \"+\", \"-\""}
+	}
+
+	*d = direction
+
+	return nil
+}
+
+// Sign returns 1 for incomes and -1 for outcomes.
+func (d Direction) Sign() int64 {
+	if d == Outcome {
+		return -1
+	}
+
+	return 1
+}
+
+// OperationID is the id of an operation: either a string or an integer kept in its decimal form.
+type OperationID struct {
+	Text    string
+	Numeric bool
+}
+
+func (id OperationID) String() string {
+	if id.Numeric {
+		return id.Text
+	}
+
+	return strconv.Quote(id.Text)
+}
+
+// canonical returns the id identifying the operation: numeric ids written differently (1, 1.0, 1e0) are the same id,
+// while the output keeps the form of the statement. String ids are never equal to numeric ones.
+func (id OperationID) canonical() OperationID {
+	if !id.Numeric {
+		return id
+	}
+
+	if n, ok := integerOf(json.Number(id.Text)); ok {
+		return OperationID{Text: strconv.FormatInt(n, 10), Numeric: true}
+	}
+
+	return id
+}
+
+// MarshalJSON writes numeric ids as JSON numbers and the rest as JSON strings.
+func (id OperationID) MarshalJSON() ([]byte, error) {
+	if id.Numeric {
+		return []byte(id.Text), nil
+	}
+
+	return json.Marshal(id.Text)
+}
+
+// UnmarshalJSON reads the id from a JSON number or a JSON string.
+func (id *OperationID) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case string:
+		*id = OperationID{Text: v}
+	case json.Number:
+		*id = OperationID{Text: v.String(), Numeric: true}
+	default:
+		return InvalidInputError{msg: "operation id can only be a JSON number or a JSON string"}
+	}
+
+	return nil
+}
+
+// NormalizedOperation is a checked bill with typed fields.
+type NormalizedOperation struct {
+	Company   string
+	Direction Direction
+	Amount    int64
+	ID        OperationID
+	CreatedAt time.Time
+	// Counterparty is the other company of a transfer, the operation is booked to it in the opposite direction.
+	Counterparty string
+	// Origin is the company of the bill for the leg of a transfer booked to the counterparty and empty for the
+	// operations of the company itself: the leg does not share the ids of the counterparty's own operations.
+	Origin string
+	// Err is the InvalidBill error of an invalid operation, Direction and Amount are not set in this case.
+	Err error
+}
+
+// Valid says whether the operation is counted in the balance.
+func (op NormalizedOperation) Valid() bool {
+	return op.Err == nil
+}
+
+// Signed returns the amount with the sign of the direction.
+func (op NormalizedOperation) Signed() int64 {
+	return op.Direction.Sign() * op.Amount
+}
+
+// Normalize checks the Bill for validity by the rules of the task and converts it to the NormalizedOperation.
+func Normalize(bill Bill) (NormalizedOperation, error) {
+	return DefaultProcessor().Normalize(bill)
+}
+
+// NormalizeBills converts the Bill slice to operations by the rules of the task.
+func NormalizeBills(bills []Bill) ([]NormalizedOperation, Stats) {
+	return DefaultProcessor().NormalizeBills(bills)
+}
+
+// Normalize checks the Bill for validity and converts it to the NormalizedOperation. An UnsupportedBill error means
+// that the bill must be skipped, an InvalidBill error is also set in the Err field of the operation.
+func (p Processor) Normalize(bill Bill) (NormalizedOperation, error) {
+	var op NormalizedOperation
+
+	company, errCompany := parseCompany(bill.Company)
+
+	if errCompany == nil {
+		company, errCompany = checkCompany(p.Companies.Canonical(company))
+	}
+
+	body, createdAt, errOperation := resolveOperation(bill)
+
+	if err := worstError(errCompany, errOperation); err != nil {
+		return op, err
+	}
+
+	if body == nil {
+		return op, UnsupportedBill{msg: "operation body was not passed"}
+	}
+
+	createdTime, errCreatedAt := p.Profile.parseCreatedAt(createdAt)
+	id, errID := parseID(body.ID)
+	direction, errType := p.Profile.parseType(body.Type)
+	amount, errValue := parseValue(body.Value)
+	counterparty, errCounterparty := p.parseCounterparty(body.Counterparty, company)
+
+	var err error
+
+	for _, e := range [...]error{errCreatedAt, errID, errType, errValue, errCounterparty} {
+		err = worstError(err, e)
+	}
+
+	if isUnsupported(err) {
+		return op, err
+	}
+
+	op = NormalizedOperation{
+		Company:   company,
+		ID:        id,
+		CreatedAt: createdTime,
+		Err:       err,
+	}
+
+	if err == nil {
+		op.Direction = direction
+		op.Amount = amount
+		op.Counterparty = counterparty
+	}
+
+	if errRules := checkRules(p.Rules, op); errRules != nil {
+		if err = worstError(err, errRules); isUnsupported(err) {
+			return NormalizedOperation{}, err
+		}
+
+		op.Direction, op.Amount, op.Counterparty, op.Err = 0, 0, "", err
+	}
+
+	return op, err
+}
+
+// NormalizeBills converts the Bill slice to operations skipping unsupported bills and counts the bills by the result
+// of their check. A valid transfer is followed by its leg booked to the counterparty.
+func (p Processor) NormalizeBills(bills []Bill) ([]NormalizedOperation, Stats) {
+	if p.Workers > 1 {
+		return p.normalizeConcurrently(bills)
+	}
+
+	return p.normalizeChunk(bills)
+}
+
+// normalizeChunk converts the bills to operations sequentially.
+func (p Processor) normalizeChunk(bills []Bill) ([]NormalizedOperation, Stats) {
+	ops := make([]NormalizedOperation, 0, len(bills))
+	stats := Stats{Bills: len(bills)}
+
+	for _, bill := range bills {
+		op, err := p.Normalize(bill)
+
+		switch err.(type) {
+		case UnsupportedBill:
+			stats.Unsupported++
+
+			continue
+		case InvalidBill:
+			stats.Invalid++
+		case nil:
+			stats.Valid++
+		}
+
+		ops = append(ops, op)
+
+		if op.Valid() && op.IsTransfer() {
+			ops = append(ops, op.counterLeg())
+		}
+	}
+
+	return ops, stats
+}
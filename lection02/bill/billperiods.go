@@ -0,0 +1,229 @@
+package bill
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimeRange is the half-open interval [From, To) of creation times, a zero bound means no bound.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Contains says whether the time is in the range.
+func (r TimeRange) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// Filter returns the operations created in the range.
+func (r TimeRange) Filter(ops []NormalizedOperation) []NormalizedOperation {
+	if r.From.IsZero() && r.To.IsZero() {
+		return ops
+	}
+
+	result := make([]NormalizedOperation, 0, len(ops))
+
+	for _, op := range ops {
+		if r.Contains(op.CreatedAt) {
+			result = append(result, op)
+		}
+	}
+
+	return result
+}
+
+// rangeLayouts are the accepted layouts of the range bounds, dates are in UTC.
+var rangeLayouts = [...]string{time.RFC3339, "2006-01-02"}
+
+// ParseTimeRange parses the bounds of the range (RFC3339 or a date), an empty bound means no bound.
+func ParseTimeRange(from, to string) (TimeRange, error) {
+	var r TimeRange
+
+	for _, bound := range [...]struct {
+		str string
+		t   *time.Time
+	}{{from, &r.From}, {to, &r.To}} {
+		if bound.str == "" {
+			continue
+		}
+
+		t, ok := parseRangeBound(bound.str)
+
+		if !ok {
+			return TimeRange{}, InvalidInputError{msg: "time range bound \"" + bound.str +
+				"\" must be in RFC3339 or \"2006-01-02\" format"}
+		}
+
+		*bound.t = t
+	}
+
+	if !r.From.IsZero() && !r.To.IsZero() && !r.From.Before(r.To) {
+		return TimeRange{}, InvalidInputError{msg: "the beginning of the time range must be before its end"}
+	}
+
+	return r, nil
+}
+
+func parseRangeBound(str string) (time.Time, bool) {
+	for _, layout := range rangeLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Period is the length of the buckets of a balance breakdown.
+type Period string
+
+const (
+	PeriodNone  Period = ""
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+)
+
+// ParsePeriod checks the name of the period, an empty name means no breakdown.
+func ParsePeriod(name string) (Period, error) {
+	switch period := Period(strings.ToLower(name)); period {
+	case PeriodNone, PeriodDay, PeriodWeek, PeriodMonth:
+		return period, nil
+	default:
+		return "", InvalidInputError{msg: "period can only take one of the values: \"day\", \"week\", \"month\""}
+	}
+}
+
+// start returns the beginning of the bucket containing the time. Buckets are in UTC, weeks start on Monday.
+func (p Period) start(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+
+	switch p {
+	case PeriodWeek:
+		weekday := (int(t.UTC().Weekday()) + 6) % 7
+
+		return time.Date(year, month, day-weekday, 0, 0, 0, 0, time.UTC)
+	case PeriodMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// next returns the beginning of the bucket following the one that starts at the time.
+func (p Period) next(start time.Time) time.Time {
+	switch p {
+	case PeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// PeriodReport is the balance of a company in a bucket of the breakdown. Income and Outcome are the totals of
+// incomes and outcomes, so ClosingBalance = OpeningBalance + Income - Outcome.
+type PeriodReport struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	OpeningBalance int64     `json:"opening_balance"`
+	ClosingBalance int64     `json:"closing_balance"`
+	Income         int64     `json:"income"`
+	Outcome        int64     `json:"outcome"`
+}
+
+// AddPeriods breaks down the balance of each company into buckets of the period that have valid operations in the
+// range. The opening balance of a bucket includes all the earlier operations, even ones before the range.
+func AddPeriods(reports []Report, ops []NormalizedOperation, period Period, r TimeRange) []Report {
+	if period == PeriodNone {
+		return reports
+	}
+
+	byCompany := map[string][]NormalizedOperation{}
+
+	for _, op := range ops {
+		if op.Valid() && (r.To.IsZero() || op.CreatedAt.Before(r.To)) {
+			byCompany[op.Company] = append(byCompany[op.Company], op)
+		}
+	}
+
+	result := make([]Report, len(reports))
+
+	for i, report := range reports {
+		report.Periods = breakdown(byCompany[report.Company], period, r)
+		result[i] = report
+	}
+
+	return result
+}
+
+// breakdown calculates the buckets for the valid operations of a company.
+func breakdown(ops []NormalizedOperation, period Period, r TimeRange) []PeriodReport {
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].CreatedAt.Before(ops[j].CreatedAt)
+	})
+
+	var (
+		periods []PeriodReport
+		balance int64
+	)
+
+	for _, op := range ops {
+		if !r.Contains(op.CreatedAt) {
+			balance += op.Signed()
+
+			continue
+		}
+
+		start := period.start(op.CreatedAt)
+
+		if len(periods) == 0 || !periods[len(periods)-1].Start.Equal(start) {
+			periods = append(periods, PeriodReport{
+				Start:          start,
+				End:            period.next(start),
+				OpeningBalance: balance,
+				ClosingBalance: balance,
+			})
+		}
+
+		current := &periods[len(periods)-1]
+
+		if op.Direction == Outcome {
+			current.Outcome -= op.Signed()
+		} else {
+			current.Income += op.Signed()
+		}
+
+		balance += op.Signed()
+		current.ClosingBalance = balance
+	}
+
+	return periods
+}
+
+var (
+	fromArg = flag.String("from", "",
+		"Process operations created at or after the time (RFC3339 or \"2006-01-02\")")
+	toArg = flag.String("to", "",
+		"Process operations created before the time (RFC3339 or \"2006-01-02\")")
+	periodArg = flag.String("period", "",
+		"Break down the balance of each company by day, week or month")
+)
+
+// GetTimeRange returns the range passed in --from and --to or ENV FROM and TO (in order of priority).
+func GetTimeRange() (TimeRange, error) {
+	parseFlags()
+
+	return ParseTimeRange(flagOrEnv(*fromArg, "FROM"), flagOrEnv(*toArg, "TO"))
+}
+
+// GetPeriod returns the period passed in --period or ENV PERIOD (in order of priority).
+func GetPeriod() (Period, error) {
+	parseFlags()
+
+	return ParsePeriod(flagOrEnv(*periodArg, "PERIOD"))
+}
@@ -3,170 +3,234 @@ package bill
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"sort"
-	"strconv"
-	"time"
 )
 
-type InfoInvalid struct {
-	CreatedAt int64
-	ID        ID
+type Report struct {
+	Company              string         `json:"company"`
+	ValidOperationsCount uint           `json:"valid_operations_count"`
+	Balance              int64          `json:"balance"`
+	InvalidOperations    []OperationID  `json:"invalid_operations"`
+	Periods              []PeriodReport `json:"periods,omitempty"`
+	Flags                []Flag         `json:"flags,omitempty"`
 }
 
-type Report struct {
-	Company              string      `json:"company"`
-	ValidOperationsCount uint        `json:"valid_operations_count"`
-	Balance              int         `json:"balance"`
-	InvalidOperations    interface{} `json:"invalid_operations,omitempty"`
+// Processor converts bills to reports according to its settings.
+type Processor struct {
+	Profile Profile
+	// Companies turns the variants of company names into the canonical names.
+	Companies CompanyNames
+	// Rules are the extra checks applied to operations after the rules of the task.
+	Rules []Rule
+	// Duplicates is the policy for operations of a company with the same id.
+	Duplicates DuplicatePolicy
+	// Range limits the creation time of the reported operations.
+	Range TimeRange
+	// Period is the length of the buckets of the balance breakdown, no breakdown if not set.
+	Period Period
+	// Workers is the number of goroutines normalizing bills and aggregating operations, sequential if not greater
+	// than 1. The result does not depend on it; rules must be safe for concurrent use.
+	Workers int
+	// Alerts sets up the flags of reports, no flags if not set.
+	Alerts *AlertConfig
 }
 
-// ProcessBills parses the Bill slice and writes the report to a file (.json format).
-func ProcessBills(bills []Bill, outputFileName string) error {
-	output, err := os.Create(outputFileName)
-	defer DeferClose(output)
+// DefaultProcessor returns the processor following the rules of the task.
+func DefaultProcessor() Processor {
+	return Processor{
+		Profile:    StrictProfile(),
+		Duplicates: DuplicatesKeepAll,
+	}
+}
 
-	if err != nil {
-		return err
+// Deduplicate applies the duplicate policy of the processor to the operations.
+func (p Processor) Deduplicate(ops []NormalizedOperation) ([]NormalizedOperation, []Conflict) {
+	return Deduplicate(ops, p.Duplicates)
+}
+
+// Stats contains the numbers of bills by the result of their check.
+type Stats struct {
+	Bills       int
+	Valid       int
+	Invalid     int
+	Unsupported int
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d bills: %d valid, %d invalid, %d unsupported", s.Bills, s.Valid, s.Invalid, s.Unsupported)
+}
+
+// Add returns the sum of the statistics.
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Bills:       s.Bills + other.Bills,
+		Valid:       s.Valid + other.Valid,
+		Invalid:     s.Invalid + other.Invalid,
+		Unsupported: s.Unsupported + other.Unsupported,
 	}
+}
+
+// CountBills checks the Bill slice and counts the bills by the result of the check.
+func CountBills(bills []Bill) Stats {
+	_, stats := NormalizeBills(bills)
+
+	return stats
+}
+
+// ProcessBills parses the Bill slice and writes the report to the output (.json format).
+func ProcessBills(bills []Bill, output Output) error {
+	return WriteReports(MakeReports(bills), output)
+}
 
-	encoder := json.NewEncoder(output)
+// WriteReports writes the reports to the output (.json format).
+func WriteReports(reports []Report, output Output) error {
+	return output.Write(func(w io.Writer) error {
+		return EncodeReports(w, reports)
+	})
+}
+
+// EncodeReports writes the reports to the stream (.json format indented with tabs).
+func EncodeReports(w io.Writer, reports []Report) error {
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "\t")
-	reportMap := map[string]Report{}
 
-	for _, bill := range bills {
-		err = checkBill(bill)
+	return encoder.Encode(reports)
+}
+
+// MakeReports parses the Bill slice by the rules of the task and calculates a report for each company.
+func MakeReports(bills []Bill) []Report {
+	return DefaultProcessor().MakeReports(bills)
+}
 
-		switch err.(type) {
-		case UnsupportedBill:
-			continue
-		case InvalidBill:
-			var createdAt *CreatedAt
-
-			if bill.Operation != nil && bill.Operation.CreatedAt != nil {
-				createdAt = bill.Operation.CreatedAt
-			}
-
-			if bill.OperationStruct != nil && bill.OperationStruct.CreatedAt != nil {
-				createdAt = bill.OperationStruct.CreatedAt
-			}
-
-			timeStr, _ := parseCreatedAt(createdAt)
-			timeTime, _ := time.Parse(time.RFC3339, *timeStr)
-			unixTime := timeTime.Unix()
-
-			var id *ID
-
-			if bill.Operation != nil && bill.Operation.Body != nil && bill.Operation.Body.ID != nil {
-				id = bill.Operation.Body.ID
-			}
-
-			if bill.OperationStruct != nil && bill.OperationStruct.Body != nil && bill.OperationStruct.Body.ID != nil {
-				id = bill.OperationStruct.Body.ID
-			}
-
-			companyPtr, _ := parseCompany(bill.Company)
-			company := *companyPtr
-			report, ok := reportMap[company]
-
-			if !ok {
-				report = Report{
-					Company:           company,
-					InvalidOperations: []InfoInvalid{},
-				}
-			}
-
-			report.InvalidOperations = append((report.InvalidOperations).([]InfoInvalid), InfoInvalid{
-				CreatedAt: unixTime,
-				ID:        *id,
-			})
-			reportMap[company] = report
-		case nil:
-			var (
-				tp    *Type
-				value *Value
-			)
-
-			if bill.Operation != nil && bill.Operation.Body != nil {
-				tp = bill.Operation.Body.Type
-				value = bill.Operation.Body.Value
-			}
-
-			if bill.OperationStruct != nil && bill.OperationStruct.Body != nil && bill.OperationStruct.Body.Value != nil {
-				tp = bill.OperationStruct.Body.Type
-				value = bill.OperationStruct.Body.Value
-			}
-
-			var profit int
-			valueFlt, _, _ := parseValue(value)
-
-			if valueFlt != nil {
-				valueStr := fmt.Sprintf("%.0f", *valueFlt)
-				profit, _ = strconv.Atoi(valueStr)
-			} else {
-				_, valueStr, _ := parseValue(value)
-				profit, _ = strconv.Atoi(*valueStr)
-			}
-
-			operationTypePtr, _ := parseType(tp)
-			operationType := *operationTypePtr
-
-			if operationType == "outcome" || operationType == "-" {
-				profit *= -1
-			}
-
-			companyPtr, _ := parseCompany(bill.Company)
-			company := *companyPtr
-			report, ok := reportMap[company]
-
-			if !ok {
-				report = Report{
-					Company:           company,
-					InvalidOperations: []InfoInvalid{},
-				}
-			}
-
-			report.ValidOperationsCount++
-			report.Balance += profit
-			reportMap[company] = report
-		}
+// MakeReports parses the Bill slice and calculates a report for each company sorted by company name.
+func (p Processor) MakeReports(bills []Bill) []Report {
+	ops, _ := p.NormalizeBills(bills)
+	ops, _ = p.Deduplicate(ops)
+
+	return p.Aggregate(ops)
+}
+
+// Aggregate calculates the reports on the operations in the range of the processor with the balance breakdown.
+func (p Processor) Aggregate(ops []NormalizedOperation) []Report {
+	var reports []Report
+	inRange := p.Range.Filter(ops)
+
+	if p.Workers > 1 {
+		reports = aggregateConcurrently(inRange, p.Workers)
+	} else {
+		reports = Aggregate(inRange)
 	}
 
-	for company := range reportMap {
-		if reportMap[company].InvalidOperations == nil {
+	if p.Alerts != nil {
+		p.Alerts.Flag(reports, inRange)
+	}
+
+	return AddPeriods(reports, ops, p.Period, p.Range)
+}
+
+// aggregate is a report on a company being calculated.
+type aggregate struct {
+	report  Report
+	invalid []InvalidOperation
+}
+
+// aggregates are the reports on companies being calculated.
+type aggregates map[string]*aggregate
+
+// Aggregate calculates a report for each company on the operations. Reports are sorted by company name, ids of
+// invalid operations are sorted by creation time.
+func Aggregate(ops []NormalizedOperation) []Report {
+	aggs := aggregates{}
+	aggs.add(ops)
+
+	return aggs.reports()
+}
+
+// add accounts the operations in the aggregates.
+func (aggs aggregates) add(ops []NormalizedOperation) {
+	for _, op := range ops {
+		agg := aggs.get(op.Company)
+
+		if !op.Valid() {
+			agg.invalid = append(agg.invalid, InvalidOperation{ID: op.ID, CreatedAt: op.CreatedAt})
+
 			continue
 		}
 
-		sort.Slice(reportMap[company].InvalidOperations, func(i, j int) bool {
-			invalidOperations := (reportMap[company].InvalidOperations).([]InfoInvalid)
+		agg.report.ValidOperationsCount++
+		agg.report.Balance += op.Signed()
+	}
+}
 
-			return invalidOperations[i].CreatedAt < invalidOperations[j].CreatedAt
-		})
+func (aggs aggregates) get(company string) *aggregate {
+	agg, ok := aggs[company]
 
-		invalidOperations := (reportMap[company].InvalidOperations).([]InfoInvalid)
-		ids := make([]ID, 0, len(invalidOperations))
+	if !ok {
+		agg = &aggregate{report: Report{Company: company}}
+		aggs[company] = agg
+	}
 
-		for _, invalidOperation := range invalidOperations {
-			ids = append(ids, invalidOperation.ID)
-		}
+	return agg
+}
 
-		reportMap[company] = Report{
-			Company:              company,
-			ValidOperationsCount: reportMap[company].ValidOperationsCount,
-			Balance:              reportMap[company].Balance,
-			InvalidOperations:    ids,
-		}
+// merge adds the aggregates calculated on the operations following the ones of aggs.
+func (aggs aggregates) merge(other aggregates) {
+	for company, otherAgg := range other {
+		agg := aggs.get(company)
+		agg.report.ValidOperationsCount += otherAgg.report.ValidOperationsCount
+		agg.report.Balance += otherAgg.report.Balance
+		agg.invalid = append(agg.invalid, otherAgg.invalid...)
 	}
+}
+
+// reports finishes the calculation of the reports.
+func (aggs aggregates) reports() []Report {
+	reports := make([]Report, 0, len(aggs))
 
-	reports := make([]Report, 0, len(reportMap))
+	for _, agg := range aggs {
+		sortInvalid(agg.invalid)
+		// The list is written even if it is empty.
+		agg.report.InvalidOperations = make([]OperationID, 0, len(agg.invalid))
 
-	for _, report := range reportMap {
-		reports = append(reports, report)
+		for _, op := range agg.invalid {
+			agg.report.InvalidOperations = append(agg.report.InvalidOperations, op.ID)
+		}
+
+		reports = append(reports, agg.report)
 	}
 
 	sort.Slice(reports, func(i, j int) bool {
 		return reports[i].Company < reports[j].Company
 	})
 
-	return encoder.Encode(reports)
+	return reports
+}
+
+// sortInvalid sorts the invalid operations by creation time, operations created at the same time keep the order of
+// input. Unlike sort.SliceStable, it runs in O(n log n).
+func sortInvalid(invalid []InvalidOperation) {
+	order := make([]int, len(invalid))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(a, b int) bool {
+		timeA, timeB := invalid[order[a]].CreatedAt, invalid[order[b]].CreatedAt
+
+		if !timeA.Equal(timeB) {
+			return timeA.Before(timeB)
+		}
+
+		return order[a] < order[b]
+	})
+
+	sorted := make([]InvalidOperation, len(invalid))
+
+	for i, j := range order {
+		sorted[i] = invalid[j]
+	}
+
+	copy(invalid, sorted)
 }
@@ -0,0 +1,178 @@
+package bill
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"time"
+)
+
+// Names of the profiles.
+const (
+	ProfileStrict  = "strict"
+	ProfileLenient = "lenient"
+	ProfileCustom  = "custom"
+)
+
+// Profile is a set of leniency rules for operation types and creation times. The types "income", "outcome", "+", "-"
+// are always accepted.
+type Profile struct {
+	// CaseInsensitiveTypes allows operation types and their synonyms in any case.
+	CaseInsensitiveTypes bool
+	// TypeSynonyms are extra operation types.
+	TypeSynonyms map[string]Direction
+	// TimeLayouts are the accepted layouts of "created_at" in the order they are tried.
+	TimeLayouts []string
+	// Location is the time zone of timestamps without a zone, UTC if not set.
+	Location *time.Location
+}
+
+// StrictProfile returns the profile following the task: lower-case types and RFC3339 timestamps.
+func StrictProfile() Profile {
+	return Profile{
+		TimeLayouts: []string{time.RFC3339},
+	}
+}
+
+// LenientProfile returns the profile that accepts types in any case with common synonyms and timestamps with or
+// without a zone (considered UTC).
+func LenientProfile() Profile {
+	return Profile{
+		CaseInsensitiveTypes: true,
+		TypeSynonyms: map[string]Direction{
+			"in":         Income,
+			"credit":     Income,
+			"deposit":    Income,
+			"out":        Outcome,
+			"debit":      Outcome,
+			"withdrawal": Outcome,
+		},
+		TimeLayouts: []string{
+			time.RFC3339,
+			"2006-01-02T15:04:05",
+			"2006-01-02 15:04:05Z07:00",
+			"2006-01-02 15:04:05",
+			"2006-01-02",
+		},
+		Location: time.UTC,
+	}
+}
+
+// profileFile is the format of a custom profile file.
+type profileFile struct {
+	CaseInsensitiveTypes bool                 `json:"case_insensitive_types"`
+	TypeSynonyms         map[string]Direction `json:"type_synonyms"`
+	TimeLayouts          []string             `json:"time_layouts"`
+	DefaultTimezone      string               `json:"default_timezone"`
+}
+
+// LoadProfile reads the custom profile (.json format). Time layouts default to RFC3339, the default timezone is
+// an IANA name like "Europe/Moscow".
+func LoadProfile(fileName string) (Profile, error) {
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return Profile{}, err
+	}
+
+	var file profileFile
+
+	if err = json.Unmarshal(data, &file); err != nil {
+		return Profile{}, err
+	}
+
+	profile := StrictProfile()
+	profile.CaseInsensitiveTypes = file.CaseInsensitiveTypes
+	profile.TypeSynonyms = file.TypeSynonyms
+
+	if len(file.TimeLayouts) != 0 {
+		profile.TimeLayouts = file.TimeLayouts
+	}
+
+	if file.DefaultTimezone != "" {
+		if profile.Location, err = time.LoadLocation(file.DefaultTimezone); err != nil {
+			return Profile{}, err
+		}
+	}
+
+	return profile, nil
+}
+
+var (
+	profileArg = flag.String("profile", "",
+		"Leniency profile for operation types and timestamps: strict (default), lenient or custom")
+	profileFileArg = flag.String("profile-file", "",
+		"File of the custom profile (.json format), implies --profile custom")
+)
+
+// GetProfile returns the profile chosen in the flags or ENV PROFILE and PROFILE_FILE (in order of priority).
+func GetProfile() (Profile, error) {
+	parseFlags()
+
+	name := FormatQuotes(*profileArg)
+	fileName := FormatQuotes(*profileFileArg)
+
+	if name == "" && fileName == "" {
+		name = FormatQuotes(os.Getenv("PROFILE"))
+		fileName = FormatQuotes(os.Getenv("PROFILE_FILE"))
+	}
+
+	if name == "" && fileName != "" {
+		name = ProfileCustom
+	}
+
+	switch strings.ToLower(name) {
+	case "", ProfileStrict:
+		return StrictProfile(), nil
+	case ProfileLenient:
+		return LenientProfile(), nil
+	case ProfileCustom:
+		if fileName == "" {
+			return Profile{}, InvalidInputError{msg: "custom profile requires --profile-file"}
+		}
+
+		return LoadProfile(fileName)
+	default:
+		return Profile{}, InvalidInputError{msg: "profile can only take one of the values: \"strict\", \"lenient\", \"custom\""}
+	}
+}
+
+// direction returns the direction of the operation type according to the profile.
+func (p Profile) direction(opType string) (Direction, bool) {
+	if p.CaseInsensitiveTypes {
+		opType = strings.ToLower(opType)
+	}
+
+	switch opType {
+	case "income", "+":
+		return Income, true
+	case "outcome", "-":
+		return Outcome, true
+	}
+
+	for synonym, direction := range p.TypeSynonyms {
+		if synonym == opType || p.CaseInsensitiveTypes && strings.EqualFold(synonym, opType) {
+			return direction, true
+		}
+	}
+
+	return 0, false
+}
+
+// parseTime parses the timestamp in one of the layouts of the profile.
+func (p Profile) parseTime(str string) (time.Time, bool) {
+	location := p.Location
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	for _, layout := range p.TimeLayouts {
+		if t, err := time.ParseInLocation(layout, str, location); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
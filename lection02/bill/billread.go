@@ -1,11 +1,40 @@
 package bill
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
+// StdinName is the name of the input read from the standard input stream.
+const StdinName = "stdin"
+
+// stdinPattern is the file name that means reading from the standard input stream.
+const stdinPattern = "-"
+
+// statementExts are the extensions of the files taken from a directory of statements.
+var statementExts = map[string]bool{
+	".json":   true,
+	".ndjson": true,
+	".jsonl":  true,
+	".csv":    true,
+	gzipExt:   true,
+}
+
+const gzipExt = ".gz"
+
+// gzipMagic are the first bytes of any gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
 type InvalidInputError struct {
 	msg string
 }
@@ -14,54 +43,401 @@ func (e InvalidInputError) Error() string {
 	return e.msg
 }
 
-// GetInput searches for a file with input data.
-func GetInput() (*os.File, error) {
-	type InputGetter func() (*os.File, error)
+// Format is a format of statements.
+type Format string
 
-	flags := func() (*os.File, error) {
-		fileArg := flag.String("file", "",
-			"File of statements of financial operations of companies (.json format)")
-		flag.Parse()
-		fileName := FormatQuotes(*fileArg)
+const (
+	// FormatJSON is a JSON array of bills or newline-delimited JSON.
+	FormatJSON Format = "json"
+	// FormatCSV is a CSV table of bills with a header.
+	FormatCSV Format = "csv"
+)
+
+// Input is an opened source of statements.
+type Input struct {
+	Name   string
+	File   *os.File
+	Format Format
+}
 
-		return os.Open(fileName)
+// fileList is a flag that can be passed several times.
+type fileList []string
+
+func (l *fileList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(value string) error {
+	*l = append(*l, value)
+
+	return nil
+}
+
+var (
+	fileArgs  fileList
+	formatArg = flag.String("format", "",
+		"Format of the statements: json (JSON array or NDJSON) or csv; detected by the file extension if not passed")
+	strictInputArg = flag.Bool("strict-input", false,
+		"Fail if the files passed in the flags, the arguments or ENV FILE cannot be opened instead of trying the next "+
+			"source of statements")
+)
+
+func init() {
+	flag.Var(&fileArgs, "file",
+		"File, glob or directory of statements of financial operations of companies "+
+			"(.json, .ndjson or .csv format, optionally gzip-compressed), "+
+			"can be passed several times; the rest of the arguments are treated the same way")
+}
+
+// GetInput searches for files with input data. Files, globs and directories passed in the flags and arguments,
+// ENV FILE (a list separated by the OS path list separator) and stdin are tried in order of priority, "-" among the
+// files means stdin. A source that was passed but cannot be opened is reported to stderr and the next one is tried, or
+// its error is returned in the strict mode. Stdin is used as the last resort only if the statement is piped into it.
+func GetInput() ([]Input, error) {
+	flags := func() ([]Input, error) {
+		parseFlags()
+		patterns := append(append([]string{}, fileArgs...), flag.Args()...)
+
+		if len(patterns) == 0 {
+			return nil, errSourceNotPassed
+		}
+
+		return openPatterns(patterns)
 	}
 
-	env := func() (*os.File, error) {
-		fileName, ok := os.LookupEnv("FILE")
+	env := func() ([]Input, error) {
+		fileNames, ok := os.LookupEnv("FILE")
 
 		if !ok {
-			return nil, InvalidInputError{msg: "Environment variable was not passed"}
+			return nil, errSourceNotPassed
+		}
+
+		return openPatterns(filepath.SplitList(fileNames))
+	}
+
+	stdin := func() ([]Input, error) {
+		if stdinIsTerminal() {
+			return nil, InvalidInputError{msg: "no statement is piped, pass a file or redirect the statement to stdin"}
 		}
 
-		fileName = FormatQuotes(fileName)
+		return []Input{stdinInput()}, nil
+	}
+
+	format := Format(strings.ToLower(FormatQuotes(*formatArg)))
 
-		return os.Open(fileName)
+	if format != "" && format != FormatJSON && format != FormatCSV {
+		return nil, InvalidInputError{msg: "Format can only take one of the values: \"json\", \"csv\""}
 	}
 
-	stdin := func() (*os.File, error) {
-		return os.Stdin, nil
+	sources := [...]inputSource{
+		{name: "flags and arguments", open: flags},
+		{name: "ENV FILE", open: env},
+		{name: StdinName, open: stdin},
 	}
 
-	for _, inputGetter := range [...]InputGetter{flags, env, stdin} {
-		input, err := inputGetter()
+	var err error
+
+	for i, source := range sources {
+		var inputs []Input
+		inputs, err = source.open()
+
+		if errors.Is(err, errSourceNotPassed) {
+			continue
+		}
+
+		if err != nil {
+			err = SourceError{Source: source.name, Err: err}
+
+			if *strictInputArg || i == len(sources)-1 {
+				return nil, err
+			}
+
+			fmt.Fprintf(os.Stderr, "%v, trying the next source\n", err)
+
+			continue
+		}
 
-		if err == nil {
-			return input, nil
+		for j := range inputs {
+			if format != "" {
+				inputs[j].Format = format
+			}
 		}
+
+		return inputs, nil
 	}
 
-	return nil, InvalidInputError{msg: "Input stream was not passed"}
+	return nil, err
 }
 
-// ReadBills decodes the file with bills.
-func ReadBills(input *os.File) ([]Bill, error) {
-	var bills []Bill
-	err := json.NewDecoder(input).Decode(&bills)
+// inputSource is a source of statements tried by GetInput.
+type inputSource struct {
+	name string
+	open func() ([]Input, error)
+}
+
+// errSourceNotPassed means that the source was not specified, so the next one is tried silently.
+var errSourceNotPassed = errors.New("source was not passed")
+
+// SourceError says why a source of statements could not be opened.
+type SourceError struct {
+	Source string
+	Err    error
+}
+
+func (e SourceError) Error() string {
+	return e.Source + ": " + e.Err.Error()
+}
+
+func (e SourceError) Unwrap() error {
+	return e.Err
+}
+
+// stdinInput returns the input of the standard input stream.
+func stdinInput() Input {
+	return Input{Name: StdinName, File: os.Stdin, Format: FormatJSON}
+}
+
+// stdinIsTerminal says whether stdin is an interactive terminal (or another character device such as /dev/null)
+// rather than a pipe or a file.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// OpenInput opens the statement file and detects its format by the extension.
+func OpenInput(fileName string) (Input, error) {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return Input{}, err
+	}
+
+	return Input{Name: fileName, File: file, Format: detectFormat(fileName)}, nil
+}
+
+// detectFormat detects the format of the statement by the file extension.
+func detectFormat(fileName string) Format {
+	if filepath.Ext(strings.TrimSuffix(fileName, gzipExt)) == ".csv" {
+		return FormatCSV
+	}
+
+	return FormatJSON
+}
+
+// CloseInputs closes all the inputs except stdin.
+func CloseInputs(inputs []Input) {
+	for _, input := range inputs {
+		if input.File == os.Stdin {
+			continue
+		}
+
+		DeferClose(input.File)
+	}
+}
+
+// openPatterns opens all the files matched by the patterns, "-" means stdin. If at least one of them cannot be opened,
+// no input is returned.
+func openPatterns(patterns []string) ([]Input, error) {
+	var inputs []Input
+	stdinUsed := false
+
+	for _, pattern := range patterns {
+		if FormatQuotes(pattern) == stdinPattern {
+			if stdinUsed {
+				CloseInputs(inputs)
+
+				return nil, InvalidInputError{msg: "Stdin can only be read once"}
+			}
+
+			stdinUsed = true
+			inputs = append(inputs, stdinInput())
+
+			continue
+		}
+
+		fileNames, err := expandPattern(FormatQuotes(pattern))
+
+		if err != nil {
+			CloseInputs(inputs)
+
+			return nil, err
+		}
+
+		for _, fileName := range fileNames {
+			input, err := OpenInput(fileName)
+
+			if err != nil {
+				CloseInputs(inputs)
+
+				return nil, err
+			}
+
+			inputs = append(inputs, input)
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, InvalidInputError{msg: "No statement files were found"}
+	}
+
+	return inputs, nil
+}
+
+// expandPattern returns the names of the files matched by the glob, contained in the directory (reports written by
+// this package are skipped) or the name itself.
+func expandPattern(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, InvalidInputError{msg: "Empty file name"}
+	}
+
+	if strings.ContainsAny(pattern, "*?[") {
+		fileNames, err := filepath.Glob(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fileNames) == 0 {
+			return nil, InvalidInputError{msg: "No files match the pattern \"" + pattern + "\""}
+		}
+
+		sort.Strings(fileNames)
+
+		return fileNames, nil
+	}
+
+	info, err := os.Stat(pattern)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if !info.IsDir() {
+		return []string{pattern}, nil
+	}
+
+	entries, err := os.ReadDir(pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fileNames []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !IsStatementFile(name) {
+			continue
+		}
+
+		fileNames = append(fileNames, filepath.Join(pattern, name))
+	}
+
+	return fileNames, nil
+}
+
+// IsStatementFile says whether the file taken from a directory is a statement: it has a statement extension and is
+// not a report or an alerts section written by this package or a hidden file.
+func IsStatementFile(fileName string) bool {
+	name := filepath.Base(fileName)
+
+	return statementExts[filepath.Ext(name)] && !strings.HasSuffix(name, reportSuffix) &&
+		!strings.HasSuffix(name, AlertsSuffix) && !strings.HasPrefix(name, ".")
+}
+
+// ReadInput decodes the input with bills according to its format.
+func ReadInput(input Input, mapping CSVMapping) ([]Bill, error) {
+	if input.Format == FormatCSV {
+		return ReadCSVBills(input.File, mapping)
+	}
+
+	return ReadBills(input.File)
+}
+
+// ReadBills decodes the statement with bills. The statement is either a JSON array or newline-delimited JSON (a bill
+// per line), gzip-compressed statements are detected by the magic bytes and decompressed.
+func ReadBills(input io.Reader) ([]Bill, error) {
+	reader, err := decompress(bufio.NewReader(input))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeBills(reader)
+}
+
+// decodeBills decodes the decompressed statement with bills.
+func decodeBills(reader *bufio.Reader) ([]Bill, error) {
+	first, err := firstToken(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(reader)
+
+	if first == '[' {
+		var bills []Bill
+
+		if err = decoder.Decode(&bills); err != nil {
+			return nil, err
+		}
+
+		return bills, nil
+	}
+
+	var bills []Bill
+
+	for decoder.More() {
+		var bill Bill
+
+		if err = decoder.Decode(&bill); err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(bills)+1, err)
+		}
+
+		bills = append(bills, bill)
+	}
+
 	return bills, nil
 }
+
+// decompress returns the reader of the decompressed stream if the input is compressed with gzip.
+func decompress(input *bufio.Reader) (*bufio.Reader, error) {
+	magic, err := input.Peek(len(gzipMagic))
+
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		return input, nil
+	}
+
+	gzipReader, err := gzip.NewReader(input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bufio.NewReader(gzipReader), nil
+}
+
+// firstToken returns the first non-whitespace byte of the input without consuming it.
+func firstToken(input *bufio.Reader) (byte, error) {
+	for {
+		b, err := input.Peek(1)
+
+		if err == io.EOF {
+			return 0, InvalidInputError{msg: "Statement is empty"}
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = input.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package bill
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rule is an extra domain check of operations. Check returns nil for operations that satisfy the rule, otherwise an
+// InvalidBill or an UnsupportedBill error; any other error is treated according to the severity of the rule.
+type Rule interface {
+	Name() string
+	Check(op NormalizedOperation) error
+}
+
+// RuleFactory builds a rule from its configuration object in the rules file.
+type RuleFactory func(config json.RawMessage) (Rule, error)
+
+// Severities of rules.
+const (
+	SeverityInvalid     = "invalid"
+	SeverityUnsupported = "unsupported"
+)
+
+var ruleFactories = map[string]RuleFactory{
+	"max_value":           newMaxValueRule,
+	"forbidden_companies": newForbiddenCompaniesRule,
+	"id_format":           newIDFormatRule,
+	"not_in_future":       newNotInFutureRule,
+}
+
+// RegisterRule makes the rule available in rules files under the name. A rule with the same name is replaced.
+func RegisterRule(name string, factory RuleFactory) {
+	ruleFactories[name] = factory
+}
+
+// RuleNames returns the sorted names of the registered rules.
+func RuleNames() []string {
+	names := make([]string, 0, len(ruleFactories))
+
+	for name := range ruleFactories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ruleConfig contains the fields common for all rules in the rules file.
+type ruleConfig struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+}
+
+// severityRule converts the violations of the rule to the error of its severity.
+type severityRule struct {
+	Rule
+	severity string
+}
+
+func (r severityRule) Check(op NormalizedOperation) error {
+	err := r.Rule.Check(op)
+
+	switch err.(type) {
+	case nil, InvalidBill, UnsupportedBill:
+		return err
+	}
+
+	msg := "rule \"" + r.Name() + "\": " + err.Error()
+
+	if r.severity == SeverityUnsupported {
+		return UnsupportedBill{msg: msg}
+	}
+
+	return InvalidBill{msg: msg}
+}
+
+// LoadRules reads the rules file (.json format): an array of objects with the name of the rule in the "rule" field,
+// an optional "severity" ("invalid" by default or "unsupported") and the parameters of the rule.
+func LoadRules(fileName string) ([]Rule, error) {
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []json.RawMessage
+
+	if err = json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+
+	rules := make([]Rule, 0, len(configs))
+
+	for i, raw := range configs {
+		var config ruleConfig
+
+		if err = json.Unmarshal(raw, &config); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+
+		factory, ok := ruleFactories[config.Rule]
+
+		if !ok {
+			return nil, InvalidInputError{msg: fmt.Sprintf("rule %d: unknown rule \"%s\", known rules: %s",
+				i+1, config.Rule, strings.Join(RuleNames(), ", "))}
+		}
+
+		if config.Severity == "" {
+			config.Severity = SeverityInvalid
+		}
+
+		if config.Severity != SeverityInvalid && config.Severity != SeverityUnsupported {
+			return nil, InvalidInputError{msg: fmt.Sprintf("rule %d: severity can only take one of the values: "+
+				"\"invalid\", \"unsupported\"", i+1)}
+		}
+
+		rule, err := factory(raw)
+
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, config.Rule, err)
+		}
+
+		rules = append(rules, severityRule{Rule: rule, severity: config.Severity})
+	}
+
+	return rules, nil
+}
+
+var rulesFileArg = flag.String("rules-file", "",
+	"File of extra validation rules (.json format)")
+
+// GetRules loads the rules from the file passed in --rules-file or ENV RULES_FILE (in order of priority).
+func GetRules() ([]Rule, error) {
+	parseFlags()
+	fileName := flagOrEnv(*rulesFileArg, "RULES_FILE")
+
+	if fileName == "" {
+		return nil, nil
+	}
+
+	return LoadRules(fileName)
+}
+
+// checkRules applies the rules to the operation and returns the worst of their errors.
+func checkRules(rules []Rule, op NormalizedOperation) error {
+	var err error
+
+	for _, rule := range rules {
+		err = worstError(err, rule.Check(op))
+	}
+
+	return err
+}
+
+// maxValueRule limits the absolute amount of a valid operation.
+type maxValueRule struct {
+	max int64
+}
+
+func newMaxValueRule(config json.RawMessage) (Rule, error) {
+	var params struct {
+		Max *int64 `json:"max"`
+	}
+
+	if err := json.Unmarshal(config, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Max == nil || *params.Max < 0 {
+		return nil, InvalidInputError{msg: "\"max\" must be passed and must not be negative"}
+	}
+
+	return maxValueRule{max: *params.Max}, nil
+}
+
+func (r maxValueRule) Name() string {
+	return "max_value"
+}
+
+// Check compares the absolute amount: a negative value of an outcome is an income of the same size.
+func (r maxValueRule) Check(op NormalizedOperation) error {
+	if op.Valid() && (op.Amount > r.max || op.Amount < -r.max) {
+		return fmt.Errorf("value %d exceeds %d in absolute value", op.Amount, r.max)
+	}
+
+	return nil
+}
+
+// forbiddenCompaniesRule rejects the operations of the listed companies.
+type forbiddenCompaniesRule struct {
+	Companies []string `json:"companies"`
+}
+
+func newForbiddenCompaniesRule(config json.RawMessage) (Rule, error) {
+	var rule forbiddenCompaniesRule
+
+	if err := json.Unmarshal(config, &rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (r forbiddenCompaniesRule) Name() string {
+	return "forbidden_companies"
+}
+
+func (r forbiddenCompaniesRule) Check(op NormalizedOperation) error {
+	for _, company := range r.Companies {
+		if op.Company == company {
+			return fmt.Errorf("company \"%s\" is forbidden", company)
+		}
+	}
+
+	return nil
+}
+
+// idFormatRule requires ids to match the regular expression.
+type idFormatRule struct {
+	pattern *regexp.Regexp
+}
+
+func newIDFormatRule(config json.RawMessage) (Rule, error) {
+	var params struct {
+		Pattern string `json:"pattern"`
+	}
+
+	if err := json.Unmarshal(config, &params); err != nil {
+		return nil, err
+	}
+
+	pattern, err := regexp.Compile(params.Pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idFormatRule{pattern: pattern}, nil
+}
+
+func (r idFormatRule) Name() string {
+	return "id_format"
+}
+
+func (r idFormatRule) Check(op NormalizedOperation) error {
+	if !r.pattern.MatchString(op.ID.Text) {
+		return fmt.Errorf("id %v does not match \"%s\"", op.ID, r.pattern)
+	}
+
+	return nil
+}
+
+// notInFutureRule rejects operations created later than now plus the tolerance.
+type notInFutureRule struct {
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+func newNotInFutureRule(config json.RawMessage) (Rule, error) {
+	var params struct {
+		Tolerance string `json:"tolerance"`
+	}
+
+	if err := json.Unmarshal(config, &params); err != nil {
+		return nil, err
+	}
+
+	rule := notInFutureRule{now: time.Now}
+
+	if params.Tolerance != "" {
+		tolerance, err := time.ParseDuration(params.Tolerance)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rule.tolerance = tolerance
+	}
+
+	return rule, nil
+}
+
+func (r notInFutureRule) Name() string {
+	return "not_in_future"
+}
+
+func (r notInFutureRule) Check(op NormalizedOperation) error {
+	if op.CreatedAt.After(r.now().Add(r.tolerance)) {
+		return fmt.Errorf("operation is created in the future: %s", op.CreatedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
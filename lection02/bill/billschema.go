@@ -0,0 +1,251 @@
+package bill
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StatementSchema is the JSON Schema of the statement format (a JSON array of bills; every line of an NDJSON
+// statement is a bill of the same schema). The body of the operation and created_at may be in the root of the bill or
+// in the operation, each of them in one place. Bills that break the value constraints are still read and reported as
+// invalid or unsupported, the schema describes the statements that are processed completely.
+const StatementSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "Statement of financial operations of companies",
+	"type": "array",
+	"items": {"$ref": "#/$defs/bill"},
+	"$defs": {
+		"bill": {
+			"type": "object",
+			"properties": {
+				"company": {"type": "string", "minLength": 1},
+				"type": {"$ref": "#/$defs/type"},
+				"value": {"$ref": "#/$defs/value"},
+				"id": {"$ref": "#/$defs/id"},
+				"created_at": {"$ref": "#/$defs/created_at"},
+				"counterparty": {"$ref": "#/$defs/counterparty"},
+				"operation": {"$ref": "#/$defs/operation"}
+			},
+			"required": ["company"],
+			"additionalProperties": false,
+			"oneOf": [
+				{
+					"description": "The body and created_at are in the root.",
+					"required": ["type", "value", "id", "created_at"],
+					"not": {"required": ["operation"]}
+				},
+				{
+					"description": "The body and created_at are in the operation.",
+					"required": ["operation"],
+					"properties": {"operation": {"required": ["type", "value", "id", "created_at"]}},
+					"not": {"anyOf": [{"$ref": "#/$defs/body"}, {"required": ["created_at"]}]}
+				},
+				{
+					"description": "The body is in the root, created_at is in the operation.",
+					"required": ["type", "value", "id", "operation"],
+					"properties": {
+						"operation": {
+							"required": ["created_at"],
+							"not": {"$ref": "#/$defs/body"}
+						}
+					},
+					"not": {"required": ["created_at"]}
+				},
+				{
+					"description": "The body is in the operation, created_at is in the root.",
+					"required": ["created_at", "operation"],
+					"properties": {
+						"operation": {
+							"required": ["type", "value", "id"],
+							"not": {"required": ["created_at"]}
+						}
+					},
+					"not": {"$ref": "#/$defs/body"}
+				}
+			]
+		},
+		"operation": {
+			"type": "object",
+			"properties": {
+				"type": {"$ref": "#/$defs/type"},
+				"value": {"$ref": "#/$defs/value"},
+				"id": {"$ref": "#/$defs/id"},
+				"created_at": {"$ref": "#/$defs/created_at"},
+				"counterparty": {"$ref": "#/$defs/counterparty"}
+			},
+			"additionalProperties": false
+		},
+		"body": {
+			"description": "An object with any of the fields of the operation body.",
+			"anyOf": [
+				{"required": ["type"]},
+				{"required": ["value"]},
+				{"required": ["id"]},
+				{"required": ["counterparty"]}
+			]
+		},
+		"type": {"enum": ["income", "outcome", "+", "-"]},
+		"value": {
+			"oneOf": [
+				{"type": "integer"},
+				{"type": "string", "pattern": "^[+-]?[0-9]+$"}
+			]
+		},
+		"id": {
+			"oneOf": [
+				{"type": "integer"},
+				{"type": "string", "minLength": 1}
+			]
+		},
+		"created_at": {"type": "string", "format": "date-time"},
+		"counterparty": {"type": "string", "minLength": 1}
+	}
+}
+`
+
+// Fields of the statement format, the JSON decoder matches them case-insensitively.
+var (
+	billFields      = [...]string{"company", "type", "value", "id", "created_at", "counterparty", "operation"}
+	operationFields = [...]string{"type", "value", "id", "created_at", "counterparty"}
+)
+
+// plainBill has the fields of Bill without its decoding method.
+type plainBill Bill
+
+// UnmarshalJSON decodes the bill and remembers its unknown fields.
+func (b *Bill) UnmarshalJSON(data []byte) error {
+	var bill plainBill
+	// Numbers are kept as json.Number: float64 would make large ids lose precision and 1.0 indistinguishable from 1.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&bill); err != nil {
+		return err
+	}
+
+	*b = Bill(bill)
+	b.unknown = unknownFields(data)
+
+	return nil
+}
+
+// UnknownFields returns the fields of the bill that are not part of the statement format (they are ignored), sorted
+// by name. The fields of the nested operation are prefixed with "operation.".
+func (b Bill) UnknownFields() []string {
+	return b.unknown
+}
+
+// unknownFields returns the unknown fields of the JSON object of the bill.
+func unknownFields(data []byte) []string {
+	var fields map[string]json.RawMessage
+
+	if json.Unmarshal(data, &fields) != nil {
+		return nil
+	}
+
+	var unknown []string
+
+	for name, value := range fields {
+		if !knownField(name, billFields[:]) {
+			unknown = append(unknown, name)
+
+			continue
+		}
+
+		var opFields map[string]json.RawMessage
+
+		if !strings.EqualFold(name, "operation") || json.Unmarshal(value, &opFields) != nil {
+			continue
+		}
+
+		for opName := range opFields {
+			if !knownField(opName, operationFields[:]) {
+				unknown = append(unknown, "operation."+opName)
+			}
+		}
+	}
+
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+func knownField(name string, fields []string) bool {
+	for _, field := range fields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CountUnknownFields returns the number of bills containing each unknown field.
+func CountUnknownFields(bills []Bill) map[string]int {
+	counts := map[string]int{}
+
+	for _, bill := range bills {
+		for _, field := range bill.unknown {
+			counts[field]++
+		}
+	}
+
+	return counts
+}
+
+// FormatFieldCounts formats the counts of the fields as "field (count), ..." sorted by field.
+func FormatFieldCounts(counts map[string]int) string {
+	fields := make([]string, 0, len(counts))
+
+	for field := range counts {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for i, field := range fields {
+		fields[i] = fmt.Sprintf("%s (%d)", field, counts[field])
+	}
+
+	return strings.Join(fields, ", ")
+}
+
+// UnknownFieldsPolicy says what to do with statements containing unknown fields.
+type UnknownFieldsPolicy string
+
+const (
+	// UnknownFieldsWarn reports the unknown fields of each bill and their counts.
+	UnknownFieldsWarn UnknownFieldsPolicy = "warn"
+	// UnknownFieldsIgnore ignores the unknown fields silently.
+	UnknownFieldsIgnore UnknownFieldsPolicy = "ignore"
+	// UnknownFieldsFail reports the unknown fields and rejects the statement.
+	UnknownFieldsFail UnknownFieldsPolicy = "fail"
+)
+
+// ParseUnknownFieldsPolicy checks the name of the policy, an empty name means UnknownFieldsWarn.
+func ParseUnknownFieldsPolicy(name string) (UnknownFieldsPolicy, error) {
+	switch policy := UnknownFieldsPolicy(strings.ToLower(name)); policy {
+	case "":
+		return UnknownFieldsWarn, nil
+	case UnknownFieldsWarn, UnknownFieldsIgnore, UnknownFieldsFail:
+		return policy, nil
+	default:
+		return "", InvalidInputError{
+			msg: "unknown fields policy can only take one of the values: \"warn\", \"ignore\", \"fail\"",
+		}
+	}
+}
+
+var unknownFieldsArg = flag.String("unknown-fields", "",
+	"Policy for fields of bills that are not part of the statement format: warn (default), ignore or fail")
+
+// GetUnknownFieldsPolicy returns the policy passed in --unknown-fields or ENV UNKNOWN_FIELDS (in order of priority).
+func GetUnknownFieldsPolicy() (UnknownFieldsPolicy, error) {
+	parseFlags()
+
+	return ParseUnknownFieldsPolicy(flagOrEnv(*unknownFieldsArg, "UNKNOWN_FIELDS"))
+}
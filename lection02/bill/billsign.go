@@ -0,0 +1,312 @@
+package bill
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Signature algorithms.
+const (
+	SignHMAC    = "hmac-sha256"
+	SignEd25519 = "ed25519"
+)
+
+// SignatureSuffix ends the name of the detached signature of a report.
+const SignatureSuffix = ".sig"
+
+// SignatureError says that the report does not match its signature.
+type SignatureError struct {
+	msg string
+}
+
+func (e SignatureError) Error() string {
+	return e.msg
+}
+
+// Signer makes detached signatures of reports.
+type Signer interface {
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks detached signatures of reports.
+type Verifier interface {
+	Algorithm() string
+	Verify(data, signature []byte) error
+}
+
+// hmacKey signs and verifies with HMAC-SHA256.
+type hmacKey []byte
+
+func (k hmacKey) Algorithm() string {
+	return SignHMAC
+}
+
+func (k hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(data)
+
+	return mac.Sum(nil), nil
+}
+
+func (k hmacKey) Verify(data, signature []byte) error {
+	expected, _ := k.Sign(data)
+
+	if !hmac.Equal(expected, signature) {
+		return SignatureError{msg: "report does not match the signature"}
+	}
+
+	return nil
+}
+
+// ed25519Signer signs with an Ed25519 private key.
+type ed25519Signer ed25519.PrivateKey
+
+func (k ed25519Signer) Algorithm() string {
+	return SignEd25519
+}
+
+func (k ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(k), data), nil
+}
+
+// ed25519Verifier verifies with an Ed25519 public key.
+type ed25519Verifier ed25519.PublicKey
+
+func (k ed25519Verifier) Algorithm() string {
+	return SignEd25519
+}
+
+func (k ed25519Verifier) Verify(data, signature []byte) error {
+	if !ed25519.Verify(ed25519.PublicKey(k), data, signature) {
+		return SignatureError{msg: "report does not match the signature"}
+	}
+
+	return nil
+}
+
+// ParseSignAlgorithm checks the name of the signature algorithm and returns its canonical name.
+func ParseSignAlgorithm(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case SignHMAC, "hmac":
+		return SignHMAC, nil
+	case SignEd25519:
+		return SignEd25519, nil
+	default:
+		return "", InvalidInputError{
+			msg: "signature algorithm can only take one of the values: \"hmac-sha256\", \"ed25519\"",
+		}
+	}
+}
+
+// LoadSigner creates the signer of the algorithm. The HMAC key is read from the key file or, if it is not passed,
+// from ENV SIGN_KEY; the Ed25519 key file is a PEM-encoded PKCS #8 private key ("openssl genpkey -algorithm ed25519").
+func LoadSigner(algorithm, keyFile string) (Signer, error) {
+	algorithm, err := ParseSignAlgorithm(algorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case SignHMAC:
+		return loadHMACKey(keyFile)
+	default:
+		key, err := loadPEM(keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		privateKey, err := x509.ParsePKCS8PrivateKey(key)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+
+		ed25519Key, ok := privateKey.(ed25519.PrivateKey)
+
+		if !ok {
+			return nil, InvalidInputError{msg: keyFile + ": not an Ed25519 private key"}
+		}
+
+		return ed25519Signer(ed25519Key), nil
+	}
+}
+
+// LoadVerifier creates the verifier of the algorithm. The HMAC key is read as in LoadSigner, the Ed25519 key file is
+// a PEM-encoded public key ("openssl pkey -pubout") or the private key.
+func LoadVerifier(algorithm, keyFile string) (Verifier, error) {
+	algorithm, err := ParseSignAlgorithm(algorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case SignHMAC:
+		return loadHMACKey(keyFile)
+	default:
+		key, err := loadPEM(keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if publicKey, err := x509.ParsePKIXPublicKey(key); err == nil {
+			if ed25519Key, ok := publicKey.(ed25519.PublicKey); ok {
+				return ed25519Verifier(ed25519Key), nil
+			}
+		}
+
+		if privateKey, err := x509.ParsePKCS8PrivateKey(key); err == nil {
+			if ed25519Key, ok := privateKey.(ed25519.PrivateKey); ok {
+				return ed25519Verifier(ed25519Key.Public().(ed25519.PublicKey)), nil
+			}
+		}
+
+		return nil, InvalidInputError{msg: keyFile + ": not an Ed25519 key"}
+	}
+}
+
+func loadHMACKey(keyFile string) (hmacKey, error) {
+	key := []byte(os.Getenv("SIGN_KEY"))
+
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// A public key must not become a secret: anyone could sign with it.
+		if block, _ := pem.Decode(data); block != nil {
+			return nil, InvalidInputError{msg: keyFile + ": PEM-encoded keys cannot be HMAC keys"}
+		}
+
+		key = bytes.TrimRight(data, "\r\n")
+	}
+
+	if len(key) == 0 {
+		return nil, InvalidInputError{msg: "HMAC key was not passed: set ENV SIGN_KEY or pass a key file"}
+	}
+
+	return key, nil
+}
+
+// loadPEM returns the content of the PEM block of the key file.
+func loadPEM(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return nil, InvalidInputError{msg: "Ed25519 requires a key file"}
+	}
+
+	data, err := os.ReadFile(keyFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, InvalidInputError{msg: keyFile + ": no PEM-encoded key found"}
+	}
+
+	return block.Bytes, nil
+}
+
+// EncodeSignature writes the detached signature: the algorithm and the base64-encoded signature on a line.
+func EncodeSignature(w io.Writer, algorithm string, signature []byte) error {
+	_, err := fmt.Fprintf(w, "%s %s\n", algorithm, base64.StdEncoding.EncodeToString(signature))
+
+	return err
+}
+
+// ReadSignature reads the detached signature and returns its algorithm and the signature itself.
+func ReadSignature(fileName string) (string, []byte, error) {
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	fields := strings.Fields(string(data))
+
+	if len(fields) != 2 {
+		return "", nil, InvalidInputError{msg: fileName + ": signature must be \"algorithm base64\""}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(fields[1])
+
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return fields[0], signature, nil
+}
+
+// VerifyReport checks the report file against its detached signature with the key file of the algorithm (see
+// LoadVerifier). The algorithm is set by the verifier, not by the signature file: a signature made with another
+// algorithm does not match.
+func VerifyReport(reportFile, signatureFile, algorithm, keyFile string) error {
+	algorithm, err := ParseSignAlgorithm(algorithm)
+
+	if err != nil {
+		return err
+	}
+
+	signatureAlgorithm, signature, err := ReadSignature(signatureFile)
+
+	if err != nil {
+		return err
+	}
+
+	if signed, err := ParseSignAlgorithm(signatureAlgorithm); err != nil || signed != algorithm {
+		return SignatureError{msg: fmt.Sprintf("report is signed with %q, not %q", signatureAlgorithm, algorithm)}
+	}
+
+	verifier, err := LoadVerifier(algorithm, keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(reportFile)
+
+	if err != nil {
+		return err
+	}
+
+	return verifier.Verify(data, signature)
+}
+
+var (
+	signArg = flag.String("sign", "",
+		"Write a detached signature of the report to the output file name plus \""+SignatureSuffix+"\": "+
+			"hmac-sha256 (the key is taken from ENV SIGN_KEY or --sign-key) or ed25519")
+	signKeyArg = flag.String("sign-key", "",
+		"Key file of the signature: the HMAC key or the PEM-encoded Ed25519 private key")
+)
+
+// GetSigner creates the signer passed in --sign and --sign-key or ENV SIGN and SIGN_KEY_FILE (in order of priority),
+// nil if no signature is requested.
+func GetSigner() (Signer, error) {
+	parseFlags()
+	algorithm := flagOrEnv(*signArg, "SIGN")
+
+	if algorithm == "" {
+		return nil, nil
+	}
+
+	return LoadSigner(algorithm, flagOrEnv(*signKeyArg, "SIGN_KEY_FILE"))
+}
@@ -0,0 +1,128 @@
+package bill
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeEd25519Keys writes a new Ed25519 key pair as PEM files and returns their names.
+func writeEd25519Keys(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateFile, publicFile := filepath.Join(dir, "key.pem"), filepath.Join(dir, "pub.pem")
+
+	for fileName, block := range map[string]*pem.Block{
+		privateFile: {Type: "PRIVATE KEY", Bytes: privateDER},
+		publicFile:  {Type: "PUBLIC KEY", Bytes: publicDER},
+	} {
+		if err = os.WriteFile(fileName, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return privateFile, publicFile
+}
+
+func writeSignature(t *testing.T, fileName, algorithm string, signature []byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if err := EncodeSignature(&buf, algorithm, signature); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fileName, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyEd25519Report(t *testing.T) {
+	dir := t.TempDir()
+	privateFile, publicFile := writeEd25519Keys(t, dir)
+	report, signatureFile := filepath.Join(dir, "r.json"), filepath.Join(dir, "r.json"+SignatureSuffix)
+	data := []byte(`[{"company":"a","valid_operations_count":1,"balance":1,"invalid_operations":[]}]`)
+
+	if err := os.WriteFile(report, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := LoadSigner(SignEd25519, privateFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, _ := signer.Sign(data)
+	writeSignature(t, signatureFile, SignEd25519, signature)
+
+	if err = VerifyReport(report, signatureFile, SignEd25519, publicFile); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+
+	if err = os.WriteFile(report, []byte(`[{"company":"evil","balance":1000000}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = VerifyReport(report, signatureFile, SignEd25519, publicFile); !errors.As(err, &SignatureError{}) {
+		t.Errorf("tampered report: %v, want a SignatureError", err)
+	}
+}
+
+// TestVerifyRejectsAlgorithmDowngrade forges an HMAC signature keyed by the public Ed25519 key, which must not pass
+// the verification of an Ed25519 report.
+func TestVerifyRejectsAlgorithmDowngrade(t *testing.T) {
+	dir := t.TempDir()
+	_, publicFile := writeEd25519Keys(t, dir)
+	report, signatureFile := filepath.Join(dir, "r.json"), filepath.Join(dir, "r.json"+SignatureSuffix)
+	data := []byte(`[{"company":"evil","balance":1000000}]`)
+
+	if err := os.WriteFile(report, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	publicPEM, err := os.ReadFile(publicFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, bytes.TrimRight(publicPEM, "\r\n"))
+	mac.Write(data)
+	writeSignature(t, signatureFile, SignHMAC, mac.Sum(nil))
+
+	if err = VerifyReport(report, signatureFile, SignEd25519, publicFile); !errors.As(err, &SignatureError{}) {
+		t.Errorf("HMAC signature of an Ed25519 report: %v, want a SignatureError", err)
+	}
+
+	if err = VerifyReport(report, signatureFile, SignHMAC, publicFile); err == nil {
+		t.Error("HMAC signature keyed by a public key is valid")
+	}
+}
@@ -0,0 +1,194 @@
+package bill
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// storedOperation is a record of the store file.
+type storedOperation struct {
+	Company   string      `json:"company"`
+	ID        OperationID `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Type      *Direction  `json:"type,omitempty"`
+	Value     int64       `json:"value,omitempty"`
+	// Counterparty is the other company of a transfer leg.
+	Counterparty string `json:"counterparty,omitempty"`
+	// Origin is the company of the bill of a leg booked to the counterparty.
+	Origin  string `json:"origin,omitempty"`
+	Invalid string `json:"invalid,omitempty"`
+}
+
+func storedOf(op NormalizedOperation) storedOperation {
+	stored := storedOperation{Company: op.Company, ID: op.ID, CreatedAt: op.CreatedAt, Origin: op.Origin}
+
+	if op.Valid() {
+		direction := op.Direction
+		stored.Type = &direction
+		stored.Value = op.Amount
+		stored.Counterparty = op.Counterparty
+	} else {
+		stored.Invalid = op.Err.Error()
+	}
+
+	return stored
+}
+
+func (s storedOperation) operation() NormalizedOperation {
+	op := NormalizedOperation{Company: s.Company, ID: s.ID, CreatedAt: s.CreatedAt, Origin: s.Origin}
+
+	if s.Type == nil {
+		op.Err = InvalidBill{msg: s.Invalid}
+	} else {
+		op.Direction = *s.Type
+		op.Amount = s.Value
+		op.Counterparty = s.Counterparty
+	}
+
+	return op
+}
+
+// Store is an append-only file of processed operations (a JSON record per line), which is read into memory when it
+// is opened. Operations are identified by company and id, an operation is stored once. A record torn by a crash at
+// the end of the file is discarded. The store is meant for a single process at a time.
+type Store struct {
+	file *os.File
+	ops  []NormalizedOperation
+	seen map[operationKey]bool
+}
+
+// OpenStore opens the store file, creating it if it does not exist.
+func OpenStore(fileName string) (*Store, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0o644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{file: file, seen: map[operationKey]bool{}}
+
+	if err = store.load(); err != nil {
+		DeferClose(file)
+
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return store, nil
+}
+
+// load reads the records and truncates the file after the last complete one.
+func (s *Store) load() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+
+		if err == io.EOF {
+			// A record without the trailing newline was not completely written.
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var stored storedOperation
+
+		if err = json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("record %d: %w", line, err)
+		}
+
+		op := stored.operation()
+		s.ops = append(s.ops, op)
+		s.seen[keyOf(op)] = true
+		offset += int64(len(data))
+	}
+
+	if err := s.file.Truncate(offset); err != nil {
+		return err
+	}
+
+	_, err := s.file.Seek(offset, io.SeekStart)
+
+	return err
+}
+
+// Append stores the operations that are not in the store yet and returns their number. The records are synced to
+// the disk before Append returns.
+func (s *Store) Append(ops []NormalizedOperation) (int, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	var added []NormalizedOperation
+	// skipped says whether the previous operation is stored already, the leg of a transfer is skipped with it.
+	skipped := false
+
+	for i, op := range ops {
+		key := keyOf(op)
+
+		if !legFollows(ops, i) {
+			skipped = s.seen[key]
+		}
+
+		if skipped {
+			continue
+		}
+
+		if err := encoder.Encode(storedOf(op)); err != nil {
+			return 0, err
+		}
+
+		s.seen[key] = true
+		added = append(added, op)
+	}
+
+	if len(added) == 0 {
+		return 0, nil
+	}
+
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return 0, err
+	}
+
+	s.ops = append(s.ops, added...)
+
+	return len(added), nil
+}
+
+// Operations returns the stored operations of the companies (of all companies if none are passed) in the order they
+// were stored.
+func (s *Store) Operations(companies ...string) []NormalizedOperation {
+	if len(companies) == 0 {
+		return append([]NormalizedOperation{}, s.ops...)
+	}
+
+	wanted := map[string]bool{}
+
+	for _, company := range companies {
+		wanted[company] = true
+	}
+
+	var ops []NormalizedOperation
+
+	for _, op := range s.ops {
+		if wanted[op.Company] {
+			ops = append(ops, op)
+		}
+	}
+
+	return ops
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	return s.file.Close()
+}
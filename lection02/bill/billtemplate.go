@@ -0,0 +1,168 @@
+package bill
+
+import (
+	"flag"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultTemplate is the name of the built-in HTML template of the report.
+const DefaultTemplate = "default"
+
+// defaultHTMLTemplate is the built-in template of the report.
+const defaultHTMLTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Report on financial operations</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.number { text-align: right; }
+.negative { color: #b00; }
+.flag { color: #b60; }
+</style>
+</head>
+<body>
+<h1>Report on financial operations</h1>
+<p>{{.Stats}}</p>
+<table>
+<tr><th>Company</th><th>Valid operations</th><th>Balance</th><th>Invalid operations</th></tr>
+{{- range .Reports}}
+<tr>
+<td>{{.Company}}</td>
+<td class="number">{{.ValidOperationsCount}}</td>
+<td class="number{{if lt .Balance 0}} negative{{end}}">{{.Balance}}</td>
+<td>{{range $i, $id := .InvalidOperations}}{{if $i}}, {{end}}{{$id.Text}}{{end}}</td>
+</tr>
+{{- end}}
+<tr><th>Total</th><td class="number">{{.ValidOperationsCount}}</td><td class="number">{{.TotalBalance}}</td><td></td></tr>
+</table>
+{{- range .Reports}}{{if .Periods}}
+<h2>{{.Company}}: periods</h2>
+<table>
+<tr><th>Start</th><th>End</th><th>Opening balance</th><th>Income</th><th>Outcome</th><th>Closing balance</th></tr>
+{{- range .Periods}}
+<tr>
+<td>{{.Start.Format "2006-01-02"}}</td>
+<td>{{.End.Format "2006-01-02"}}</td>
+<td class="number">{{.OpeningBalance}}</td>
+<td class="number">{{.Income}}</td>
+<td class="number">{{.Outcome}}</td>
+<td class="number">{{.ClosingBalance}}</td>
+</tr>
+{{- end}}
+</table>
+{{- end}}{{end}}
+{{- if .Alerts}}
+<h2>Alerts</h2>
+<ul>
+{{- range .Alerts}}{{$company := .Company}}{{range .Flags}}
+<li class="flag">{{$company}}: {{.Message}}</li>
+{{- end}}{{end}}
+</ul>
+{{- end}}
+{{- if .Diagnostics}}
+<h2>Diagnostics</h2>
+<ul>
+{{- range .Diagnostics}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`
+
+// TemplateData is passed to the report templates.
+type TemplateData struct {
+	Reports []Report
+	Stats   Stats
+	Alerts  []Alert
+	// Diagnostics are the messages about the input: skipped duplicates, unknown fields and so on.
+	Diagnostics []string
+}
+
+// NewTemplateData prepares the data of the report template.
+func NewTemplateData(reports []Report, stats Stats, diagnostics []string) TemplateData {
+	return TemplateData{Reports: reports, Stats: stats, Alerts: Alerts(reports), Diagnostics: diagnostics}
+}
+
+// ValidOperationsCount returns the number of valid operations of all the companies.
+func (d TemplateData) ValidOperationsCount() uint {
+	var count uint
+
+	for _, report := range d.Reports {
+		count += report.ValidOperationsCount
+	}
+
+	return count
+}
+
+// TotalBalance returns the sum of the balances of all the companies.
+func (d TemplateData) TotalBalance() int64 {
+	var total int64
+
+	for _, report := range d.Reports {
+		total += report.Balance
+	}
+
+	return total
+}
+
+// Template renders the report, both text/template and html/template templates fit it.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// LoadTemplate parses the template file: html/template is used for .html and .htm files, text/template for the
+// others. DefaultTemplate means the built-in HTML template.
+func LoadTemplate(fileName string) (Template, error) {
+	if fileName == DefaultTemplate {
+		return htmltemplate.New(DefaultTemplate).Parse(defaultHTMLTemplate)
+	}
+
+	data, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(fileName)
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".html", ".htm":
+		return htmltemplate.New(name).Parse(string(data))
+	default:
+		return texttemplate.New(name).Parse(string(data))
+	}
+}
+
+// WriteRendered renders the report with the template to the output.
+func WriteRendered(tmpl Template, data TemplateData, output Output) error {
+	return output.Write(func(w io.Writer) error {
+		return tmpl.Execute(w, data)
+	})
+}
+
+var templateArg = flag.String("template", "",
+	"Render the report with the template file (html/template for .html files, text/template for others) instead "+
+		"of writing JSON, \""+DefaultTemplate+"\" means the built-in HTML template")
+
+// GetTemplate loads the template passed in --template or ENV TEMPLATE (in order of priority), nil if it is not
+// passed.
+func GetTemplate() (Template, error) {
+	parseFlags()
+	fileName := flagOrEnv(*templateArg, "TEMPLATE")
+
+	if fileName == "" {
+		return nil, nil
+	}
+
+	return LoadTemplate(fileName)
+}
@@ -0,0 +1,113 @@
+package bill
+
+import (
+	"fmt"
+)
+
+// parseCounterparty checks the counterparty of a transfer and returns its canonical name, no counterparty means an
+// ordinary operation.
+func (p Processor) parseCounterparty(counterparty *Company, company string) (string, error) {
+	if counterparty == nil {
+		return "", nil
+	}
+
+	invalidCounterparty := InvalidBill{msg: "counterparty can only be a non-empty string other than the company"}
+	str, ok := (*counterparty).(string)
+
+	if !ok {
+		return "", invalidCounterparty
+	}
+
+	str = p.Companies.Canonical(str)
+
+	if str == "" || str == company {
+		return "", invalidCounterparty
+	}
+
+	return str, nil
+}
+
+// IsTransfer says whether the operation is a leg of a transfer between companies.
+func (op NormalizedOperation) IsTransfer() bool {
+	return op.Counterparty != ""
+}
+
+// counterLeg returns the leg of the transfer booked to the counterparty: the same amount in the opposite direction.
+func (op NormalizedOperation) counterLeg() NormalizedOperation {
+	leg := op
+	leg.Company, leg.Counterparty, leg.Origin = op.Counterparty, op.Company, op.Company
+
+	if op.Direction == Income {
+		leg.Direction = Outcome
+	} else {
+		leg.Direction = Income
+	}
+
+	return leg
+}
+
+// legFollows says whether the operation is the leg of the transfer before it, as NormalizeBills returns them.
+func legFollows(ops []NormalizedOperation, i int) bool {
+	if i == 0 || ops[i].Origin == "" {
+		return false
+	}
+
+	leg, transfer := ops[i], ops[i-1]
+
+	return transfer.IsTransfer() && transfer.Origin == "" && leg.Origin == transfer.Company &&
+		leg.Company == transfer.Counterparty && leg.ID == transfer.ID && leg.CreatedAt.Equal(transfer.CreatedAt)
+}
+
+// transferKey identifies a transfer by its id, the company of its bill and the counterparty.
+type transferKey struct {
+	id   OperationID
+	from string
+	to   string
+}
+
+func transferKeyOf(op NormalizedOperation) transferKey {
+	if op.Origin != "" {
+		return transferKey{id: op.ID.canonical(), from: op.Origin, to: op.Company}
+	}
+
+	return transferKey{id: op.ID.canonical(), from: op.Company, to: op.Counterparty}
+}
+
+// CheckTransfers checks that the transfers between companies preserve the total balance: both legs of every valid
+// transfer in the range are booked, and the balances of the reports add up to the sum of the operations with the
+// outside world. A leg may be lost, for example, when the duplicate policy removes it.
+func (p Processor) CheckTransfers(reports []Report, ops []NormalizedOperation) error {
+	ops = p.Range.Filter(ops)
+	legs := map[transferKey]int64{}
+	var external int64
+
+	for _, op := range ops {
+		switch {
+		case !op.Valid():
+		case op.IsTransfer():
+			legs[transferKeyOf(op)] += op.Signed()
+		default:
+			external += op.Signed()
+		}
+	}
+
+	for _, op := range ops {
+		if key := transferKeyOf(op); op.Valid() && op.IsTransfer() && legs[key] != 0 {
+			return InvalidInputError{msg: fmt.Sprintf("transfer %v from \"%s\" to \"%s\" is not balanced",
+				op.ID, key.from, key.to)}
+		}
+	}
+
+	var total int64
+
+	for _, report := range reports {
+		total += report.Balance
+	}
+
+	if total != external {
+		return InvalidInputError{msg: fmt.Sprintf(
+			"total balance of the companies %d differs from the sum of the external operations %d", total, external)}
+	}
+
+	return nil
+}
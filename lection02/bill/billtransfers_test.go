@@ -0,0 +1,95 @@
+package bill
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func readStatement(t *testing.T, statement string) []Bill {
+	t.Helper()
+
+	var bills []Bill
+
+	if err := json.Unmarshal([]byte(statement), &bills); err != nil {
+		t.Fatal(err)
+	}
+
+	return bills
+}
+
+// TestTransferLegsKeepTheirIDs checks that the leg of a transfer booked to the counterparty does not collide with the
+// counterparty's own operation with the same id, and that it shares the fate of a duplicated transfer.
+func TestTransferLegsKeepTheirIDs(t *testing.T) {
+	cases := []struct {
+		name      string
+		statement string
+		// valid are the numbers of valid operations of "a" by the policy.
+		valid map[DuplicatePolicy]uint
+	}{
+		{
+			name: "id of the counterparty",
+			statement: `[
+				{"company":"a","type":"+","value":10,"id":5,"created_at":"2021-10-13T12:02:39Z"},
+				{"company":"b","type":"-","value":3,"id":5,"counterparty":"a","created_at":"2021-10-13T12:02:40Z"}
+			]`,
+			valid: map[DuplicatePolicy]uint{
+				DuplicatesKeepAll: 2, DuplicatesKeepFirst: 2, DuplicatesKeepLatest: 2, DuplicatesReject: 2,
+			},
+		},
+		{
+			name: "duplicated transfer",
+			statement: `[
+				{"company":"a","type":"+","value":10,"id":5,"created_at":"2021-10-13T12:02:39Z"},
+				{"company":"a","type":"-","value":3,"id":5,"counterparty":"b","created_at":"2021-10-13T12:02:40Z"}
+			]`,
+			valid: map[DuplicatePolicy]uint{
+				DuplicatesKeepAll: 2, DuplicatesKeepFirst: 1, DuplicatesKeepLatest: 1, DuplicatesReject: 0,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		bills := readStatement(t, tc.statement)
+
+		for policy, valid := range tc.valid {
+			processor := DefaultProcessor()
+			processor.Duplicates = policy
+			ops, _ := processor.NormalizeBills(bills)
+			ops, _ = processor.Deduplicate(ops)
+			reports := processor.Aggregate(ops)
+
+			if err := processor.CheckTransfers(reports, ops); err != nil {
+				t.Errorf("%s, %s: %v", tc.name, policy, err)
+
+				continue
+			}
+
+			if reports[0].ValidOperationsCount != valid {
+				t.Errorf("%s, %s: report on \"a\" is %+v, want %d valid operations", tc.name, policy, reports[0], valid)
+			}
+		}
+	}
+}
+
+// TestIncrementSkipsLegsOfSeenTransfers checks that the leg of a transfer whose id was seen before is not applied.
+func TestIncrementSkipsLegsOfSeenTransfers(t *testing.T) {
+	processor := DefaultProcessor()
+	state := State{Companies: map[string]*CompanyState{}}
+	var reports []Report
+
+	for _, statement := range [...]string{
+		`[{"company":"a","type":"+","value":10,"id":5,"created_at":"2021-10-13T12:02:39Z"}]`,
+		`[{"company":"a","type":"-","value":3,"id":5,"counterparty":"b","created_at":"2021-10-13T12:02:40Z"}]`,
+	} {
+		ops, _ := processor.NormalizeBills(readStatement(t, statement))
+		var err error
+
+		if reports, state, err = Increment(reports, state, ops); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(reports) != 1 || reports[0].Balance != 10 {
+		t.Errorf("reports are %+v, want only \"a\" with balance 10", reports)
+	}
+}
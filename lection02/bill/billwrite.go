@@ -0,0 +1,236 @@
+package bill
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultOutput is the name of the report file used when no other destination is passed.
+	DefaultOutput = "out.json"
+	// Stdout is the output name that means writing to the standard output stream.
+	Stdout = "-"
+	// reportSuffix ends the names of the reports written for separate inputs.
+	reportSuffix = ".out.json"
+)
+
+// OutputExistsError says that the output file already exists and overwriting it was not requested.
+type OutputExistsError struct {
+	msg string
+}
+
+func (e OutputExistsError) Error() string {
+	return e.msg
+}
+
+// Output describes the destination of a report.
+type Output struct {
+	FileName  string
+	Overwrite bool
+	// Signer writes the detached signature of the report next to it, no signature if not set.
+	Signer Signer
+}
+
+var (
+	outArg = flag.String("out", "",
+		"File for the report (.json format), \"-\" means stdout; the directory of the reports with --split")
+	forceArg = flag.Bool("force", false,
+		"Overwrite the output file if it already exists")
+)
+
+// GetOutput searches for the output destination (--out, ENV OUT, "out.json" - in order of priority).
+func GetOutput() Output {
+	type OutputGetter func() (string, bool)
+
+	flags := func() (string, bool) {
+		parseFlags()
+		fileName := FormatQuotes(*outArg)
+
+		return fileName, fileName != ""
+	}
+
+	env := func() (string, bool) {
+		fileName, ok := os.LookupEnv("OUT")
+		fileName = FormatQuotes(fileName)
+
+		return fileName, ok && fileName != ""
+	}
+
+	parseFlags()
+	output := Output{
+		FileName:  DefaultOutput,
+		Overwrite: *forceArg,
+	}
+
+	for _, outputGetter := range [...]OutputGetter{flags, env} {
+		if fileName, ok := outputGetter(); ok {
+			output.FileName = fileName
+
+			break
+		}
+	}
+
+	return output
+}
+
+// GetSplitOutput returns the output of separate reports: the directory passed in --out or ENV OUT, which is created
+// if it does not exist, or stdout. If no output is passed, the reports are written next to the inputs.
+func GetSplitOutput() (Output, error) {
+	output := GetOutput()
+
+	if FormatQuotes(*outArg) == "" && FormatQuotes(os.Getenv("OUT")) == "" {
+		output.FileName = ""
+
+		return output, nil
+	}
+
+	if output.FileName == Stdout {
+		return output, nil
+	}
+
+	info, err := os.Stat(output.FileName)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return output, os.MkdirAll(output.FileName, 0o755)
+	}
+
+	if err != nil {
+		return Output{}, err
+	}
+
+	if !info.IsDir() {
+		return Output{}, InvalidInputError{msg: "output \"" + output.FileName + "\" of separate reports must be a directory"}
+	}
+
+	return output, nil
+}
+
+// ForInput returns the output for the report on a single input: the report on "name.json" (or "name.json.gz") is
+// written to "name.out.json" in the output directory (if the output is a directory) or next to the input. Stdout and
+// stdin keep the output as is.
+func (o Output) ForInput(inputName string) Output {
+	if o.FileName == Stdout || inputName == StdinName {
+		return o
+	}
+
+	dir := filepath.Dir(inputName)
+
+	if info, err := os.Stat(o.FileName); err == nil && info.IsDir() {
+		dir = o.FileName
+	}
+
+	base := strings.TrimSuffix(filepath.Base(inputName), gzipExt)
+
+	return Output{
+		FileName:  filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+reportSuffix),
+		Overwrite: o.Overwrite,
+		Signer:    o.Signer,
+	}
+}
+
+// Write passes the output stream to the write function. A file is written atomically: the data goes to a temporary
+// file in the same directory, which then takes the place of the destination file. If the output has a signer, the
+// detached signature of the data is written after it.
+func (o Output) Write(write func(w io.Writer) error) error {
+	if o.FileName == Stdout {
+		if o.Signer != nil {
+			return InvalidInputError{msg: "a signed report must be written to a file"}
+		}
+
+		return write(os.Stdout)
+	}
+
+	var data bytes.Buffer
+
+	if o.Signer != nil {
+		writeReport := write
+		write = func(w io.Writer) error {
+			return writeReport(io.MultiWriter(w, &data))
+		}
+	}
+
+	if _, err := os.Stat(o.FileName); err == nil && !o.Overwrite {
+		return o.existsError()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(o.FileName), "."+filepath.Base(o.FileName)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	tempName := temp.Name()
+	defer func() {
+		_ = os.Remove(tempName)
+	}()
+
+	if err = writeTemp(temp, write); err != nil {
+		return err
+	}
+
+	if err = o.commit(tempName); err != nil {
+		return err
+	}
+
+	if o.Signer == nil {
+		return nil
+	}
+
+	signature, err := o.Signer.Sign(data.Bytes())
+
+	if err != nil {
+		return err
+	}
+
+	signatureOutput := Output{FileName: o.FileName + SignatureSuffix, Overwrite: o.Overwrite}
+
+	return signatureOutput.Write(func(w io.Writer) error {
+		return EncodeSignature(w, o.Signer.Algorithm(), signature)
+	})
+}
+
+// commit moves the written temporary file to the output file.
+func (o Output) commit(tempName string) error {
+	if o.Overwrite {
+		return os.Rename(tempName, o.FileName)
+	}
+
+	// Unlike rename, link never replaces an existing file, so a file created in the meantime is not lost.
+	if err := os.Link(tempName, o.FileName); err != nil {
+		if os.IsExist(err) {
+			return o.existsError()
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (o Output) existsError() error {
+	return OutputExistsError{msg: "output file \"" + o.FileName + "\" already exists, use --force to overwrite it"}
+}
+
+// writeTemp writes the data to the temporary file and closes it.
+func writeTemp(temp *os.File, write func(w io.Writer) error) error {
+	err := write(temp)
+
+	if err == nil {
+		err = temp.Chmod(0o644)
+	}
+
+	if err == nil {
+		err = temp.Sync()
+	}
+
+	if errClose := temp.Close(); err == nil {
+		err = errClose
+	}
+
+	return err
+}
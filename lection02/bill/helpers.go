@@ -1,7 +1,9 @@
 package bill
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -16,10 +18,26 @@ func FormatQuotes(str string) string {
 	)
 }
 
-func DeferClose(file *os.File) {
+func DeferClose(file io.Closer) {
 	err := file.Close()
 
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
+
+// parseFlags parses the command-line flags if it has not been done yet.
+func parseFlags() {
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+}
+
+// flagOrEnv returns the value of the flag or, if it is empty, of the environment variable.
+func flagOrEnv(value, env string) string {
+	if value = FormatQuotes(value); value != "" {
+		return value
+	}
+
+	return FormatQuotes(os.Getenv(env))
+}
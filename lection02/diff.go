@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lection02/bill"
+	"os"
+)
+
+// Exit codes of the diff command.
+const (
+	diffEqual   = 0
+	diffChanged = 1
+	diffFailed  = 2
+)
+
+// runDiff compares two reports (or two statements) and prints the differences for each company.
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	statements := flags.Bool("statements", false,
+		"Compare statements processed with the global flags instead of reports")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: diff [--statements] OLD NEW\n"+
+			"Prints the differences between the reports and exits with code 1 if there are any.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return diffFailed
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+
+		return diffFailed
+	}
+
+	load := loadReports
+
+	if *statements {
+		load = processStatement
+	}
+
+	oldReports, err := load(flags.Arg(0))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(0), err)
+
+		return diffFailed
+	}
+
+	newReports, err := load(flags.Arg(1))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(1), err)
+
+		return diffFailed
+	}
+
+	diffs := bill.DiffReports(oldReports, newReports)
+
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+
+	if len(diffs) != 0 {
+		return diffChanged
+	}
+
+	return diffEqual
+}
+
+// loadReports reads the report file, which must exist.
+func loadReports(fileName string) ([]bill.Report, error) {
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer bill.DeferClose(file)
+
+	return bill.ReadReports(file)
+}
+
+// processStatement reads the statement file and calculates the report on it.
+func processStatement(fileName string) ([]bill.Report, error) {
+	processor, err := newProcessor()
+
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := bill.GetCSVMapping()
+
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := bill.OpenInput(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer bill.DeferClose(input.File)
+
+	bills, err := bill.ReadInput(input, mapping)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return processor.MakeReports(bills), nil
+}
@@ -1,3 +1,5 @@
 module lection02
 
-go 1.17
+go 1.18
+
+require golang.org/x/text v0.13.0
@@ -1,34 +1,426 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"lection02/bill"
+	"os"
+	"strings"
 )
 
-const outputFileName = "out.json"
+var (
+	splitArg = flag.Bool("split", false,
+		"Write a separate report for each input file instead of merging them into one report")
+	ledgerArg = flag.Bool("ledger", false,
+		"Write the chronological ledger of valid operations with running balances instead of the report")
+	stateArg = flag.String("state", "",
+		"State file of incremental processing: only operations with new ids are applied to the previous report, "+
+			"the state is updated after the report is written. Duplicates are resolved with the policy \"first\"")
+	previousArg = flag.String("previous", "",
+		"Previous report for incremental processing, the output file if not passed")
+)
+
+// reportTemplate renders the report instead of JSON if it is set.
+var reportTemplate bill.Template
+
+// diagnostics are the messages about the input, they are printed and passed to the report template.
+type diagnostics []string
+
+// commands are run when their name is the first argument, the command returns the exit code.
+var commands = map[string]func(args []string) int{
+	"diff":   runDiff,
+	"schema": runSchema,
+	"serve":  runServe,
+	"store":  runStore,
+	"verify": runVerify,
+	"watch":  runWatch,
+}
 
 // An example how to use package bill
 func main() {
-	input, err := bill.GetInput()
-	defer bill.DeferClose(input)
+	flag.Parse()
+
+	if command, ok := commands[flag.Arg(0)]; ok {
+		os.Exit(command(flag.Args()[1:]))
+	}
+
+	os.Exit(run())
+}
+
+// run processes the statements passed in the flags and returns the exit code: 1 if any of them cannot be processed.
+func run() int {
+	inputs, err := bill.GetInput()
+	defer bill.CloseInputs(inputs)
 
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 
-		return
+		return 1
+	}
+
+	output := bill.GetOutput()
+
+	if *splitArg {
+		if output, err = bill.GetSplitOutput(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return 1
+		}
+	}
+
+	if output.Signer, err = bill.GetSigner(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	mapping, err := bill.GetCSVMapping()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	processor, err := newProcessor()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	// Increment keeps the first of the duplicates, the whole batch is deduplicated the same way.
+	if *stateArg != "" {
+		if processor.Duplicates, err = bill.IncrementalDuplicatePolicy(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return 1
+		}
+	}
+
+	unknownFields, err := bill.GetUnknownFieldsPolicy()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	if reportTemplate, err = bill.GetTemplate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	var (
+		allOps []bill.NormalizedOperation
+		total  bill.Stats
+		diag   diagnostics
+		// failed says whether a report of --split could not be written.
+		failed bool
+	)
+
+	for _, input := range inputs {
+		// reportDiag collects the diagnostics of the report: only those of the input with --split.
+		reportDiag := &diag
+
+		if *splitArg {
+			reportDiag = &diagnostics{}
+		}
+
+		bills, err := bill.ReadInput(input, mapping)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+
+			return 1
+		}
+
+		if err = checkUnknownFields(reportDiag, input.Name, bills, unknownFields); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return 1
+		}
+
+		ops, stats := processor.NormalizeBills(bills)
+		total = total.Add(stats)
+		reportDiag.add("%s: %v", input.Name, stats)
+
+		if *splitArg {
+			ops = deduplicate(reportDiag, processor, input.Name, ops)
+			err = write(processor, ops, stats, *reportDiag, output.ForInput(input.Name))
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", input.Name, err)
+				failed = true
+			}
+
+			continue
+		}
+
+		allOps = append(allOps, ops...)
+	}
+
+	if len(inputs) > 1 {
+		diag.add("total: %v", total)
+	}
+
+	if *splitArg {
+		if failed {
+			return 1
+		}
+
+		return 0
+	}
+
+	allOps = deduplicate(&diag, processor, "total", allOps)
+
+	if *stateArg != "" {
+		err = increment(processor, allOps, output)
+	} else {
+		err = write(processor, allOps, total, diag, output)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// newProcessor configures the processor with the flags and the environment.
+func newProcessor() (bill.Processor, error) {
+	profile, err := bill.GetProfile()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	companies, err := bill.GetCompanyNames()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	rules, err := bill.GetRules()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	duplicates, err := bill.GetDuplicatePolicy()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	timeRange, err := bill.GetTimeRange()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	period, err := bill.GetPeriod()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	workers, err := bill.GetWorkers()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	alerts, err := bill.GetAlertConfig()
+
+	if err != nil {
+		return bill.Processor{}, err
+	}
+
+	return bill.Processor{
+		Profile:    profile,
+		Companies:  companies,
+		Rules:      rules,
+		Duplicates: duplicates,
+		Range:      timeRange,
+		Period:     period,
+		Workers:    workers,
+		Alerts:     alerts,
+	}, nil
+}
+
+// write writes the report or the ledger on the operations to the output.
+func write(processor bill.Processor, ops []bill.NormalizedOperation, stats bill.Stats, diag diagnostics,
+	output bill.Output) error {
+	if *ledgerArg {
+		if reportTemplate != nil {
+			return fmt.Errorf("templates can only render reports, not ledgers")
+		}
+
+		return bill.WriteLedgers(processor.Ledgers(ops), output)
+	}
+
+	reports := processor.Aggregate(ops)
+
+	if err := processor.CheckTransfers(reports, ops); err != nil {
+		return err
 	}
 
-	bills, err := bill.ReadBills(input)
+	printAlerts(reports)
+
+	var err error
+
+	if reportTemplate != nil {
+		err = bill.WriteRendered(reportTemplate, bill.NewTemplateData(reports, stats, diag), output)
+	} else {
+		err = bill.WriteReports(reports, output)
+	}
 
 	if err != nil {
-		fmt.Println(err)
+		return err
+	}
 
+	return writeAlerts(processor, reports, output)
+}
+
+// writeAlerts writes the alerts section next to the report if alerts are set up, the section of a report on stdout
+// is only printed.
+func writeAlerts(processor bill.Processor, reports []bill.Report, output bill.Output) error {
+	if processor.Alerts == nil || output.FileName == bill.Stdout {
+		return nil
+	}
+
+	return bill.WriteAlerts(bill.Alerts(reports), output)
+}
+
+// add prints the message about the input and keeps it for the report template.
+func (d *diagnostics) add(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	*d = append(*d, message)
+	fmt.Fprintln(os.Stderr, message)
+}
+
+// printAlerts prints the alerts section with the flags of the companies.
+func printAlerts(reports []bill.Report) {
+	alerts := bill.Alerts(reports)
+
+	if len(alerts) == 0 {
 		return
 	}
 
-	err = bill.ProcessBills(bills, outputFileName)
+	fmt.Fprintln(os.Stderr, "alerts:")
+
+	for _, alert := range alerts {
+		for _, flag := range alert.Flags {
+			fmt.Fprintf(os.Stderr, "\t%s: %s: %s\n", alert.Company, flag.Kind, flag.Message)
+		}
+	}
+}
+
+// increment applies the new operations to the previous report and updates the state.
+func increment(processor bill.Processor, ops []bill.NormalizedOperation, output bill.Output) error {
+	if *splitArg || *ledgerArg || processor.Period != bill.PeriodNone || processor.Range != (bill.TimeRange{}) ||
+		processor.Alerts != nil || reportTemplate != nil {
+		return fmt.Errorf("incremental processing cannot be combined with --split, --ledger, --period, --from, --to, " +
+			"--alerts-file, --template")
+	}
+
+	previousName := *previousArg
+
+	if previousName == "" {
+		if output.FileName == bill.Stdout {
+			return fmt.Errorf("incremental processing to stdout requires --previous")
+		}
+
+		previousName = output.FileName
+	}
+
+	previous, err := bill.LoadReports(previousName)
 
 	if err != nil {
-		fmt.Println(err)
+		return err
+	}
+
+	state, err := bill.LoadState(*stateArg)
+
+	if err != nil {
+		return err
+	}
+
+	reports, state, err := bill.Increment(previous, state, ops)
+
+	if err != nil {
+		return err
+	}
+
+	if previousName == output.FileName {
+		output.Overwrite = true
+	}
+
+	if err = bill.WriteReports(reports, output); err != nil {
+		return err
+	}
+
+	return bill.WriteState(state, bill.Output{FileName: *stateArg, Overwrite: true})
+}
+
+// deduplicate applies the duplicate policy and reports the removed duplicates and the conflicts between them.
+func deduplicate(diag *diagnostics, processor bill.Processor, name string,
+	ops []bill.NormalizedOperation) []bill.NormalizedOperation {
+	result, conflicts := processor.Deduplicate(ops)
+
+	if removed := len(ops) - len(result); removed != 0 {
+		diag.add("%s: %d duplicates removed", name, removed)
 	}
+
+	for _, conflict := range conflicts {
+		diag.add("%s: conflicting duplicates: %v", name, conflict)
+	}
+
+	return result
+}
+
+// checkUnknownFields reports the unknown fields of the bills according to the policy, the statement is rejected with
+// an error if the policy is to fail.
+func checkUnknownFields(diag *diagnostics, name string, bills []bill.Bill, policy bill.UnknownFieldsPolicy) error {
+	if policy == bill.UnknownFieldsIgnore {
+		return nil
+	}
+
+	for i, b := range bills {
+		if fields := b.UnknownFields(); len(fields) != 0 {
+			diag.add("%s: bill %d: unknown fields: %s", name, i+1, strings.Join(fields, ", "))
+		}
+	}
+
+	counts := bill.CountUnknownFields(bills)
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	diag.add("%s: unknown fields: %s", name, bill.FormatFieldCounts(counts))
+
+	if policy == bill.UnknownFieldsFail {
+		return fmt.Errorf("%s: statement contains unknown fields", name)
+	}
+
+	return nil
+}
+
+// runSchema prints the JSON Schema of the statement format.
+func runSchema(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: schema\nPrints the JSON Schema of the statement format.")
+
+		return 2
+	}
+
+	fmt.Print(bill.StatementSchema)
+
+	return 0
 }
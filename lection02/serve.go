@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"lection02/bill"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// shutdownTimeout is the time given to the requests in progress to finish after SIGINT.
+const shutdownTimeout = 10 * time.Second
+
+// runServe starts the HTTP service processing statements until SIGINT.
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:8080", "Address to listen on")
+	maxSize := flags.Int64("max-size", bill.DefaultMaxRequestSize, "Maximum size of a statement in bytes")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: serve [--addr ADDR] [--max-size BYTES]\n"+
+			"POST /reports with a statement returns the report processed with the global flags.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	processor, err := newProcessor()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 2
+	}
+
+	mapping, err := bill.GetCSVMapping()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 2
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	server := &http.Server{
+		Addr: *addr,
+		Handler: bill.Handler{
+			Processor: processor,
+			CSV:       mapping,
+			MaxSize:   *maxSize,
+			Logger:    logger,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Signal channel for catching SIGINT (Ctrl+C) signals
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+
+	// done is closed when the requests in progress are finished after SIGINT: ListenAndServe returns as soon as the
+	// shutdown starts.
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		<-signalChan
+		logger.Print("shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Print(err)
+		}
+	}()
+
+	logger.Printf("listening on %s", *addr)
+
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Print(err)
+
+		return 1
+	}
+
+	<-done
+
+	return 0
+}
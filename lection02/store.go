@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"lection02/bill"
+	"os"
+	"strings"
+)
+
+// runStore appends statements to the store or queries the stored operations.
+func runStore(args []string) int {
+	flags := flag.NewFlagSet("store", flag.ContinueOnError)
+	companies := flags.String("company", "", "Comma-separated companies to query, all companies if not set")
+	ledger := flags.Bool("ledger", false, "Query the ledger instead of the report")
+	out := flags.String("out", bill.Stdout, "Output file of the query, \""+bill.Stdout+"\" means stdout")
+	force := flags.Bool("force", false, "Overwrite the output file of the query")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: store append DB FILE...\n"+
+			"       store query [--company NAMES] [--ledger] [--out FILE] DB\n"+
+			"Appends the operations of the statements processed with the global flags to the store DB (each operation "+
+			"is stored once), or writes the report on the stored operations in the time range of the global flags.")
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+
+		return 2
+	}
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	processor, err := newProcessor()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	switch {
+	case args[0] == "append" && flags.NArg() >= 2:
+		err = storeAppend(processor, flags.Arg(0), flags.Args()[1:])
+	case args[0] == "query" && flags.NArg() == 1:
+		var names []string
+
+		if *companies != "" {
+			names = strings.Split(*companies, ",")
+		}
+
+		output := bill.Output{FileName: *out, Overwrite: *force}
+
+		if output.Signer, err = bill.GetSigner(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return 1
+		}
+
+		err = storeQuery(processor, flags.Arg(0), names, *ledger, output)
+	default:
+		flags.Usage()
+
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// storeAppend processes the statements and appends their operations to the store.
+func storeAppend(processor bill.Processor, db string, fileNames []string) error {
+	mapping, err := bill.GetCSVMapping()
+
+	if err != nil {
+		return err
+	}
+
+	unknownFields, err := bill.GetUnknownFieldsPolicy()
+
+	if err != nil {
+		return err
+	}
+
+	store, err := bill.OpenStore(db)
+
+	if err != nil {
+		return err
+	}
+
+	defer bill.DeferClose(store)
+
+	for _, fileName := range fileNames {
+		input, err := bill.OpenInput(fileName)
+
+		if err != nil {
+			return err
+		}
+
+		bills, err := bill.ReadInput(input, mapping)
+		bill.DeferClose(input.File)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+
+		var diag diagnostics
+
+		if err = checkUnknownFields(&diag, fileName, bills, unknownFields); err != nil {
+			return err
+		}
+
+		ops, stats := processor.NormalizeBills(bills)
+		ops = deduplicate(&diag, processor, fileName, ops)
+		added, err := store.Append(ops)
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: %v, %d operations stored\n", fileName, stats, added)
+	}
+
+	return nil
+}
+
+// storeQuery writes the report or the ledger on the stored operations of the companies.
+func storeQuery(processor bill.Processor, db string, companies []string, ledger bool, output bill.Output) error {
+	if _, err := os.Stat(db); err != nil {
+		return err
+	}
+
+	store, err := bill.OpenStore(db)
+
+	if err != nil {
+		return err
+	}
+
+	defer bill.DeferClose(store)
+
+	ops := store.Operations(companies...)
+
+	if ledger {
+		return bill.WriteLedgers(processor.Ledgers(ops), output)
+	}
+
+	reports := processor.Aggregate(ops)
+	// Transfers are checked on all the stored operations: the legs of the other companies are filtered out otherwise.
+	allOps, allReports := ops, reports
+
+	if len(companies) != 0 {
+		allOps = store.Operations()
+		allReports = processor.Aggregate(allOps)
+	}
+
+	if err = processor.CheckTransfers(allReports, allOps); err != nil {
+		return err
+	}
+
+	return bill.WriteReports(reports, output)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"lection02/bill"
+	"os"
+)
+
+// Exit codes of the verify command.
+const (
+	verifyValid    = 0
+	verifyMismatch = 1
+	verifyFailed   = 2
+)
+
+// runVerify checks the report against its detached signature.
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	algorithm := flags.String("alg", "", "Expected signature algorithm: hmac-sha256 or ed25519 (required)")
+	key := flags.String("key", "",
+		"Key file: the HMAC key (ENV SIGN_KEY if not passed) or the PEM-encoded Ed25519 public key")
+	signature := flags.String("signature", "",
+		"Detached signature file, the report name plus \""+bill.SignatureSuffix+"\" if not passed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: verify --alg ALGORITHM [--key FILE] [--signature FILE] REPORT\n"+
+			"Checks the report against its signature and exits with code 1 if it does not match.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return verifyFailed
+	}
+
+	if flags.NArg() != 1 || *algorithm == "" {
+		flags.Usage()
+
+		return verifyFailed
+	}
+
+	report := flags.Arg(0)
+	signatureFile := *signature
+
+	if signatureFile == "" {
+		signatureFile = report + bill.SignatureSuffix
+	}
+
+	err := bill.VerifyReport(report, signatureFile, *algorithm, *key)
+
+	var mismatch bill.SignatureError
+
+	switch {
+	case errors.As(err, &mismatch):
+		fmt.Fprintf(os.Stderr, "%s: %v\n", report, err)
+
+		return verifyMismatch
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+
+		return verifyFailed
+	}
+
+	fmt.Printf("%s: signature is valid\n", report)
+
+	return verifyValid
+}
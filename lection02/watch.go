@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"lection02/bill"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errorSuffix ends the names of the diagnostics written next to quarantined statements.
+const errorSuffix = ".error.txt"
+
+// fileState is what is known about a file in the inbox between polls.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher processes the statements appearing in the inbox directory.
+type watcher struct {
+	processor     bill.Processor
+	mapping       bill.CSVMapping
+	unknownFields bill.UnknownFieldsPolicy
+	signer        bill.Signer
+	inbox         string
+	archive       string
+	quarantine    string
+	logger        *log.Logger
+	// seen are the files of the previous poll, a file is processed once its size and modification time stop
+	// changing between polls, so files that are still being written are not taken.
+	seen map[string]fileState
+}
+
+// runWatch polls the inbox directory and processes new statements until SIGINT.
+func runWatch(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := flags.Duration("interval", 2*time.Second, "Interval between polls of the inbox")
+	archive := flags.String("archive", "",
+		"Directory for processed statements and their reports, INBOX/archive by default")
+	quarantine := flags.String("quarantine", "",
+		"Directory for statements that cannot be processed and their diagnostics, INBOX/quarantine by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: watch [--interval DURATION] [--archive DIR] [--quarantine DIR] INBOX\n"+
+			"Processes each new statement in INBOX with the global flags: the statement is moved to the archive and "+
+			"its report is written next to it, or it is moved to the quarantine with the diagnostics.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 || *interval <= 0 {
+		flags.Usage()
+
+		return 2
+	}
+
+	w, err := newWatcher(flags.Arg(0), *archive, *quarantine)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	w.logger.Printf("watching %s", w.inbox)
+
+	for {
+		if err = w.poll(ctx); err != nil {
+			w.logger.Print(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			w.logger.Print("shutting down...")
+
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// newWatcher configures the watcher with the flags and the environment and creates its directories.
+func newWatcher(inbox, archive, quarantine string) (*watcher, error) {
+	if info, err := os.Stat(inbox); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", inbox)
+	}
+
+	if archive == "" {
+		archive = filepath.Join(inbox, "archive")
+	}
+
+	if quarantine == "" {
+		quarantine = filepath.Join(inbox, "quarantine")
+	}
+
+	for _, dir := range [...]string{archive, quarantine} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &watcher{
+		inbox:      inbox,
+		archive:    archive,
+		quarantine: quarantine,
+		logger:     log.New(os.Stderr, "", log.LstdFlags),
+		seen:       map[string]fileState{},
+	}
+
+	var err error
+
+	if w.processor, err = newProcessor(); err != nil {
+		return nil, err
+	}
+
+	if w.mapping, err = bill.GetCSVMapping(); err != nil {
+		return nil, err
+	}
+
+	if w.unknownFields, err = bill.GetUnknownFieldsPolicy(); err != nil {
+		return nil, err
+	}
+
+	if w.signer, err = bill.GetSigner(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// poll processes the statements that have not changed since the previous poll.
+func (w *watcher) poll(ctx context.Context) error {
+	entries, err := os.ReadDir(w.inbox)
+
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]fileState{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if !entry.Type().IsRegular() || !bill.IsStatementFile(name) {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			continue
+		}
+
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+
+		if previous, ok := w.seen[name]; !ok || previous != state {
+			seen[name] = state
+
+			continue
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		w.process(name)
+	}
+
+	w.seen = seen
+
+	return nil
+}
+
+// process archives the statement with its report or quarantines it with the diagnostics.
+func (w *watcher) process(name string) {
+	fileName := filepath.Join(w.inbox, name)
+	reports, fileDiagnostics, err := w.makeReports(fileName)
+
+	if err != nil {
+		w.quarantineFile(name, err, fileDiagnostics)
+
+		return
+	}
+
+	// The report is written before the statement is archived, under a name free for both of them.
+	archived := freeName(w.archive, name, func(target string) []string {
+		reportName := w.output(target).FileName
+
+		return []string{reportName, reportName + bill.SignatureSuffix, reportName + bill.AlertsSuffix}
+	})
+	output := w.output(archived)
+
+	if err = bill.WriteReports(reports, output); err == nil {
+		err = writeAlerts(w.processor, reports, output)
+	}
+
+	if err != nil {
+		w.quarantineFile(name, err, fileDiagnostics)
+
+		return
+	}
+
+	if err = os.Rename(fileName, archived); err != nil {
+		w.logger.Printf("%s: %v", name, err)
+
+		return
+	}
+
+	w.logger.Printf("%s: report written to %s", name, output.FileName)
+}
+
+// makeReports processes the statement file and returns the reports with the diagnostics of the file.
+func (w *watcher) makeReports(fileName string) ([]bill.Report, diagnostics, error) {
+	var diag diagnostics
+	input, err := bill.OpenInput(fileName)
+
+	if err != nil {
+		return nil, diag, err
+	}
+
+	bills, err := bill.ReadInput(input, w.mapping)
+	bill.DeferClose(input.File)
+
+	if err != nil {
+		return nil, diag, err
+	}
+
+	if err = checkUnknownFields(&diag, fileName, bills, w.unknownFields); err != nil {
+		return nil, diag, err
+	}
+
+	ops, stats := w.processor.NormalizeBills(bills)
+	diag.add("%s: %v", fileName, stats)
+	ops = deduplicate(&diag, w.processor, fileName, ops)
+	reports := w.processor.Aggregate(ops)
+
+	if err = w.processor.CheckTransfers(reports, ops); err != nil {
+		return nil, diag, err
+	}
+
+	return reports, diag, nil
+}
+
+// quarantineFile moves the statement to the quarantine and writes the diagnostics next to it.
+func (w *watcher) quarantineFile(name string, reason error, fileDiagnostics diagnostics) {
+	w.logger.Printf("%s: %v, moving to quarantine", name, reason)
+	quarantined, err := moveFile(filepath.Join(w.inbox, name), w.quarantine)
+
+	if err != nil {
+		w.logger.Printf("%s: %v", name, err)
+
+		return
+	}
+
+	text := fmt.Sprintln(reason)
+
+	for _, message := range fileDiagnostics {
+		text += fmt.Sprintln(message)
+	}
+
+	if err = os.WriteFile(quarantined+errorSuffix, []byte(text), 0o644); err != nil {
+		w.logger.Printf("%s: %v", name, err)
+	}
+}
+
+// output returns the output of the report on the archived statement.
+func (w *watcher) output(archived string) bill.Output {
+	return bill.Output{FileName: archived, Signer: w.signer}.ForInput(archived)
+}
+
+// moveFile moves the file into the directory under a name that is not taken yet and returns its new path.
+func moveFile(fileName, dir string) (string, error) {
+	target := freeName(dir, filepath.Base(fileName), nil)
+
+	return target, os.Rename(fileName, target)
+}
+
+// freeName returns the path of the file in the directory, numbered if needed, such that neither the path nor the
+// related paths derived from it exist.
+func freeName(dir, base string, related func(target string) []string) string {
+	stem, ext := base, ""
+
+	if i := strings.Index(base[1:], "."); i >= 0 {
+		stem, ext = base[:i+1], base[i+1:]
+	}
+
+	target := filepath.Join(dir, base)
+
+	for n := 1; taken(target, related); n++ {
+		target = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, n, ext))
+	}
+
+	return target
+}
+
+// taken says whether the path or any of its related paths exists.
+func taken(target string, related func(target string) []string) bool {
+	paths := []string{target}
+
+	if related != nil {
+		paths = append(paths, related(target)...)
+	}
+
+	for _, path := range paths {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			return true
+		}
+	}
+
+	return false
+}